@@ -0,0 +1,133 @@
+package images
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+
+	config "propper/configs"
+	logger "propper/lib/logger"
+)
+
+// Counts the requests blocked in the tabs, by the reason they were blocked.
+type blockedRequests struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newBlockedRequests() *blockedRequests {
+	return &blockedRequests{counts: map[string]int{}}
+}
+
+func (b *blockedRequests) add(reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.counts[reason] += 1
+}
+
+func (b *blockedRequests) log(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	total := 0
+	for _, count := range b.counts {
+		total += count
+	}
+	logger.Debug(ctx, "Blocked requests", "total", total, "reasons", b.counts)
+}
+
+type blockingRules struct {
+	resourceTypes map[string]bool
+	urlPatterns   []*regexp.Regexp
+	rawPatterns   []string
+}
+
+// Patterns use '*' as a wildcard for any sequence of characters.
+func wildcardToRegexp(pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(pattern)
+	return regexp.MustCompile("^" + strings.ReplaceAll(quoted, `\*`, ".*") + "$")
+}
+
+func newBlockingRules(blockImages bool) *blockingRules {
+	rules := &blockingRules{resourceTypes: map[string]bool{}}
+	for _, resourceType := range config.BLOCKED_RESOURCE_TYPES {
+		rules.resourceTypes[strings.ToLower(resourceType)] = true
+	}
+	if blockImages {
+		rules.resourceTypes[strings.ToLower(network.ResourceTypeImage.String())] = true
+	}
+	for _, pattern := range config.BLOCKED_URL_PATTERNS {
+		rules.urlPatterns = append(rules.urlPatterns, wildcardToRegexp(pattern))
+		rules.rawPatterns = append(rules.rawPatterns, pattern)
+	}
+	return rules
+}
+
+// Returns the reason to block the request, or false if it's allowed.
+func (r *blockingRules) match(url string, resourceType network.ResourceType) (string, bool) {
+	if r.resourceTypes[strings.ToLower(resourceType.String())] {
+		return resourceType.String(), true
+	}
+	for i, pattern := range r.urlPatterns {
+		if pattern.MatchString(url) {
+			return r.rawPatterns[i], true
+		}
+	}
+	return "", false
+}
+
+// Intercepts every request of the tab. Requests matching the blocking rules
+// fail, the ones to the host of the site get its extra headers, and proxy
+// authentication challenges are answered with the proxy credentials. Rules,
+// credentials and site can be nil. Must run before navigating.
+func enableInterception(ctx context.Context, rules *blockingRules, credentials *url.Userinfo, s *site, blocked *blockedRequests) chromedp.Action {
+	chromedp.ListenTarget(ctx, func(v interface{}) {
+		switch ev := v.(type) {
+		case *fetch.EventRequestPaused:
+			// listeners can't block the event loop, so the reply is sent from a new goroutine
+			go func() {
+				execCtx := cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Target)
+				var err error
+				reason, block := "", false
+				if rules != nil {
+					reason, block = rules.match(ev.Request.URL, ev.ResourceType)
+				}
+				if block {
+					blocked.add(reason)
+					err = fetch.FailRequest(ev.RequestID, network.ErrorReasonBlockedByClient).Do(execCtx)
+				} else if headers, ok := s.requestHeaders(ev.Request.URL, ev.Request.Headers); ok {
+					err = fetch.ContinueRequest(ev.RequestID).WithHeaders(headers).Do(execCtx)
+				} else {
+					err = fetch.ContinueRequest(ev.RequestID).Do(execCtx)
+				}
+				if err != nil && ctx.Err() == nil {
+					logger.Warn(ctx, "Error resolving intercepted request", "url", ev.Request.URL, "error", err)
+				}
+			}()
+		case *fetch.EventAuthRequired:
+			go func() {
+				execCtx := cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Target)
+				response := &fetch.AuthChallengeResponse{Response: fetch.AuthChallengeResponseResponseDefault}
+				if credentials != nil && ev.AuthChallenge.Source == fetch.AuthChallengeSourceProxy {
+					password, _ := credentials.Password()
+					response = &fetch.AuthChallengeResponse{
+						Response: fetch.AuthChallengeResponseResponseProvideCredentials,
+						Username: credentials.Username(),
+						Password: password,
+					}
+				}
+				err := fetch.ContinueWithAuth(ev.RequestID, response).Do(execCtx)
+				if err != nil && ctx.Err() == nil {
+					logger.Warn(ctx, "Error answering authentication challenge", "error", err)
+				}
+			}()
+		}
+	})
+	return fetch.Enable().WithHandleAuthRequests(credentials != nil)
+}
@@ -0,0 +1,33 @@
+package images
+
+import (
+	"testing"
+
+	"github.com/chromedp/cdproto/network"
+
+	config "propper/configs"
+	utils "propper/test/utils"
+)
+
+func TestBlockingRules(t *testing.T) {
+	resourceTypes, urlPatterns := config.BLOCKED_RESOURCE_TYPES, config.BLOCKED_URL_PATTERNS
+	defer func() {
+		config.BLOCKED_RESOURCE_TYPES, config.BLOCKED_URL_PATTERNS = resourceTypes, urlPatterns
+	}()
+	config.BLOCKED_RESOURCE_TYPES = []string{"font", "Media"}
+	config.BLOCKED_URL_PATTERNS = []string{"*ads.example.com/*"}
+
+	rules := newBlockingRules(false)
+	reason, blocked := rules.match("https://example.com/a.woff", network.ResourceTypeFont)
+	utils.Assert(t, true, blocked, "Expected font to be blocked")
+	utils.Assert(t, "Font", reason, "Invalid block reason")
+	reason, blocked = rules.match("https://ads.example.com/banner.js", network.ResourceTypeScript)
+	utils.Assert(t, true, blocked, "Expected ad to be blocked")
+	utils.Assert(t, "*ads.example.com/*", reason, "Invalid block reason")
+	_, blocked = rules.match("https://example.com/a.jpg", network.ResourceTypeImage)
+	utils.Assert(t, false, blocked, "Expected image to be allowed")
+
+	rules = newBlockingRules(true)
+	_, blocked = rules.match("https://example.com/a.jpg", network.ResourceTypeImage)
+	utils.Assert(t, true, blocked, "Expected image to be blocked on discovery")
+}
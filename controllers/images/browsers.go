@@ -0,0 +1,90 @@
+package images
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/chromedp/chromedp"
+
+	config "propper/configs"
+	browserpool "propper/lib/browserpool"
+
+	. "propper/types/errors"
+)
+
+// Browsers shared by every job, so concurrent requests reuse the same Chrome
+// processes and together never open more than MAX_TABS tabs.
+var browsers *browserpool.BrowserPool
+
+// Creates the shared browsers from the config, which are launched on the
+// first tab. Must be called on startup, before any job starts.
+func LoadBrowsers() {
+	browsers = browserpool.NewBrowserPool(
+		config.BROWSERS,
+		config.MAX_TABS,
+		config.BROWSER_MAX_USES,
+		time.Duration(config.BROWSER_HEALTH_CHECK_INTERVAL)*time.Second,
+		newAllocator,
+		chromedp.WithLogf(log.Printf),
+	)
+}
+
+// Connects to the DevTools endpoint in CHROME_REMOTE_URL if it's set,
+// otherwise launches a local Chrome with the configured options.
+func newAllocator(ctx context.Context) (context.Context, context.CancelFunc) {
+	if len(config.CHROME_REMOTE_URL) > 0 {
+		return chromedp.NewRemoteAllocator(ctx, config.CHROME_REMOTE_URL)
+	}
+	return chromedp.NewExecAllocator(ctx, execAllocatorOptions()...)
+}
+
+func execAllocatorOptions() []chromedp.ExecAllocatorOption {
+	opts := append([]chromedp.ExecAllocatorOption{}, chromedp.DefaultExecAllocatorOptions[:]...)
+	opts = append(opts, chromedp.Flag("headless", config.CHROME_HEADLESS))
+	if config.CHROME_NO_SANDBOX {
+		opts = append(opts, chromedp.NoSandbox)
+	}
+	if len(config.CHROME_PATH) > 0 {
+		opts = append(opts, chromedp.ExecPath(config.CHROME_PATH))
+	}
+	if len(config.CHROME_USER_AGENT) > 0 {
+		opts = append(opts, chromedp.UserAgent(config.CHROME_USER_AGENT))
+	}
+	if width, height, ok := parseWindowSize(config.CHROME_WINDOW_SIZE); ok {
+		opts = append(opts, chromedp.WindowSize(width, height))
+	}
+	if len(config.CHROME_USER_DATA_DIR) > 0 {
+		opts = append(opts, chromedp.UserDataDir(config.CHROME_USER_DATA_DIR))
+	}
+	if len(config.CHROME_PROXY_SERVER) > 0 {
+		opts = append(opts, chromedp.ProxyServer(config.CHROME_PROXY_SERVER))
+	}
+	return opts
+}
+
+// Parses sizes with the format "<width>x<height>".
+func parseWindowSize(size string) (int, int, bool) {
+	var width, height int
+	if _, err := fmt.Sscanf(size, "%dx%d", &width, &height); err != nil || width <= 0 || height <= 0 {
+		return 0, 0, false
+	}
+	return width, height, true
+}
+
+func acquireTab(ctx context.Context) (*browserpool.Tab, error) {
+	tab, err := browsers.AcquireTab(ctx)
+	if err != nil {
+		return nil, &InternalServerError{Err: "Couldn't open a browser tab", RawError: err}
+	}
+	return tab, nil
+}
+
+// Closes the shared browsers. Used when the server shuts down.
+func CloseBrowsers() {
+	if browsers == nil {
+		return
+	}
+	browsers.Close()
+}
@@ -0,0 +1,30 @@
+package images
+
+import (
+	"testing"
+
+	utils "propper/test/utils"
+)
+
+func TestParseWindowSize(t *testing.T) {
+	for _, test := range []struct {
+		size          string
+		width, height int
+		ok            bool
+	}{
+		{"1920x1080", 1920, 1080, true},
+		{"800x600", 800, 600, true},
+		{"", 0, 0, false},
+		{"1920", 0, 0, false},
+		{"1920x", 0, 0, false},
+		{"x1080", 0, 0, false},
+		{"0x1080", 0, 0, false},
+		{"1920x-1", 0, 0, false},
+		{"widexhigh", 0, 0, false},
+	} {
+		width, height, ok := parseWindowSize(test.size)
+		utils.Assert(t, test.ok, ok, "Invalid result for "+test.size)
+		utils.Assert(t, test.width, width, "Invalid width for "+test.size)
+		utils.Assert(t, test.height, height, "Invalid height for "+test.size)
+	}
+}
@@ -0,0 +1,116 @@
+package images
+
+import (
+	"context"
+	"sync"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+
+	logger "propper/lib/logger"
+)
+
+type capturedImage struct {
+	body []byte
+	// proxy used by the tab that received the image
+	proxy string
+}
+
+// Bodies of the image responses received by the tabs while loading the
+// pages, by normalized url. Lets downloadImages save them without fetching them again.
+// Holds up to maxBytes of bodies, the images received after it are fetched again.
+type capturedImages struct {
+	mu       sync.Mutex
+	bodies   map[string]capturedImage
+	size     int
+	maxBytes int
+	inFlight sync.WaitGroup
+}
+
+func newCapturedImages(maxBytes int) *capturedImages {
+	return &capturedImages{bodies: map[string]capturedImage{}, maxBytes: maxBytes}
+}
+
+// Returns false if the image doesn't fit, and isn't stored.
+func (c *capturedImages) store(url string, image capturedImage) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	size := c.size - len(c.bodies[url].body) + len(image.body)
+	if size > c.maxBytes {
+		return false
+	}
+	c.bodies[url] = image
+	c.size = size
+	return true
+}
+
+// Safe to call on a nil value, when capturing is disabled.
+func (c *capturedImages) load(url string) (capturedImage, bool) {
+	if c == nil {
+		return capturedImage{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	image, ok := c.bodies[url]
+	return image, ok
+}
+
+func (c *capturedImages) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.bodies)
+}
+
+// Waits for the bodies being retrieved from the browser.
+func (c *capturedImages) wait() {
+	if c == nil {
+		return
+	}
+	c.inFlight.Wait()
+}
+
+// Listens to the network events of the tab and stores the body of every
+// successful image response once it finishes loading.
+func captureImageResponses(ctx context.Context, captured *capturedImages, proxy string) {
+	var mu sync.Mutex
+	pending := map[network.RequestID]string{}
+
+	chromedp.ListenTarget(ctx, func(v interface{}) {
+		switch ev := v.(type) {
+		case *network.EventResponseReceived:
+			if ev.Type != network.ResourceTypeImage || ev.Response.Status != 200 {
+				return
+			}
+			url, ok := normalizeImageURL(ev.Response.URL, ev.Response.URL)
+			if !ok {
+				return
+			}
+			mu.Lock()
+			pending[ev.RequestID] = url
+			mu.Unlock()
+		case *network.EventLoadingFinished:
+			mu.Lock()
+			url, ok := pending[ev.RequestID]
+			delete(pending, ev.RequestID)
+			mu.Unlock()
+			if !ok {
+				return
+			}
+			captured.inFlight.Add(1)
+			// listeners can't block the event loop, so the body is requested from a new goroutine
+			go func() {
+				defer captured.inFlight.Done()
+				execCtx := cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Target)
+				body, err := network.GetResponseBody(ev.RequestID).Do(execCtx)
+				if err != nil {
+					logger.Warn(ctx, "Couldn't capture image", "url", url, "error", err)
+					return
+				}
+				if !captured.store(url, capturedImage{body: body, proxy: proxy}) {
+					logger.Debug(ctx, "Captured images are full, the image will be fetched again", "url", url)
+				}
+			}()
+		}
+	})
+}
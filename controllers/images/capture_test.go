@@ -0,0 +1,34 @@
+package images
+
+import (
+	"testing"
+
+	config "propper/configs"
+	utils "propper/test/utils"
+)
+
+func TestCapturedImagesAreCapped(t *testing.T) {
+	captured := newCapturedImages(10)
+	utils.Assert(t, true, captured.store("http://a.com/1.jpg", capturedImage{body: make([]byte, 6)}), "The first image should fit")
+	utils.Assert(t, false, captured.store("http://a.com/2.jpg", capturedImage{body: make([]byte, 6)}), "The second image shouldn't fit")
+	if _, ok := captured.load("http://a.com/2.jpg"); ok {
+		t.Error("An image that doesn't fit shouldn't be stored")
+	}
+	// replacing an image frees its previous body
+	utils.Assert(t, true, captured.store("http://a.com/1.jpg", capturedImage{body: make([]byte, 8)}), "The image should replace the previous one")
+	utils.Assert(t, true, captured.store("http://a.com/3.jpg", capturedImage{body: make([]byte, 2)}), "The last image should fit")
+	utils.Assert(t, 2, captured.count(), "Invalid number of captured images")
+}
+
+func TestCaptureIsRejectedWithBlockedImages(t *testing.T) {
+	capture, block := config.CAPTURE_IMAGES_ON_DISCOVERY, config.BLOCK_IMAGES_ON_DISCOVERY
+	defer func() {
+		config.CAPTURE_IMAGES_ON_DISCOVERY, config.BLOCK_IMAGES_ON_DISCOVERY = capture, block
+	}()
+	config.CAPTURE_IMAGES_ON_DISCOVERY, config.BLOCK_IMAGES_ON_DISCOVERY = true, false
+	utils.Assert(t, nil, CheckConfig(), "Capturing the images should be allowed")
+	config.BLOCK_IMAGES_ON_DISCOVERY = true
+	if CheckConfig() == nil {
+		t.Error("Expected an error capturing the blocked images")
+	}
+}
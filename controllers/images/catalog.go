@@ -0,0 +1,105 @@
+package images
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+
+	config "propper/configs"
+	catalogpkg "propper/lib/catalog"
+	logger "propper/lib/logger"
+
+	. "propper/types/errors"
+)
+
+// Catalog of the downloaded memes, nil until OpenCatalog is called. Memes
+// aren't indexed without it.
+var catalog *catalogpkg.Catalog
+
+// Opens the catalog in CATALOG_DB. Must be called on startup, before any job starts.
+func OpenCatalog() error {
+	c, err := catalogpkg.Open(config.CATALOG_DB)
+	if err != nil {
+		return err
+	}
+	catalog = c
+	return nil
+}
+
+// Memes aren't indexed once it's closed.
+func CloseCatalog() {
+	if catalog == nil {
+		return
+	}
+	if err := catalog.Close(); err != nil {
+		logger.Error(context.Background(), "Couldn't close the catalog", "error", err)
+	}
+	catalog = nil
+}
+
+// Title and tags of an image, as shown on the page.
+type MemeInfo struct {
+	Title string   `json:"title,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// The title is the alt text of the image, or its title. The tags are the
+// comma separated values of the CARD_TAGS_ATTRIBUTE attribute.
+func memeOfNode(node *cdp.Node) MemeInfo {
+	info := MemeInfo{Tags: []string{}}
+	for _, attribute := range []string{"alt", "title"} {
+		if value, exists := node.Attribute(attribute); exists && len(strings.TrimSpace(value)) > 0 {
+			info.Title = strings.TrimSpace(value)
+			break
+		}
+	}
+	if len(config.CARD_TAGS_ATTRIBUTE) == 0 {
+		return info
+	}
+	if value, exists := node.Attribute(config.CARD_TAGS_ATTRIBUTE); exists {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.ToLower(strings.TrimSpace(tag)); len(tag) > 0 {
+				info.Tags = append(info.Tags, tag)
+			}
+		}
+	}
+	return info
+}
+
+// Adds to the catalog the images saved by the job. Near duplicates aren't
+// indexed, as their file is removed.
+func indexMemes(ctx context.Context, j *job, records []ImageRecord) {
+	if catalog == nil {
+		return
+	}
+	entries := []catalogpkg.Entry{}
+	for _, record := range records {
+		if len(record.DuplicateOf) > 0 {
+			continue
+		}
+		entry := catalogpkg.Entry{Url: record.Url, Site: config.SITE_URL, FileHash: record.Sha256}
+		if value, ok := j.memes.Load(record.Url); ok {
+			info := value.(MemeInfo)
+			entry.Title, entry.Tags = info.Title, info.Tags
+		}
+		entries = append(entries, entry)
+	}
+	if err := catalog.Add(entries, time.Now().UTC()); err != nil {
+		logger.Warn(ctx, "Couldn't index the memes in the catalog", "error", err)
+		return
+	}
+	logger.Debug(ctx, "Memes indexed in the catalog", "memes", len(entries))
+}
+
+func SearchMemes(query catalogpkg.Query) ([]catalogpkg.Entry, error) {
+	if catalog == nil {
+		return nil, &InternalServerError{Err: "The catalog isn't open"}
+	}
+	entries, err := catalog.Search(query)
+	if err != nil {
+		return nil, &InternalServerError{Err: "Unexpected error searching the catalog", RawError: err}
+	}
+	return entries, nil
+}
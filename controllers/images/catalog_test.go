@@ -0,0 +1,56 @@
+package images
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/chromedp/cdproto/cdp"
+
+	config "propper/configs"
+	catalogpkg "propper/lib/catalog"
+	utils "propper/test/utils"
+)
+
+func TestMemeOfNode(t *testing.T) {
+	node := &cdp.Node{Attributes: []string{"alt", " Grumpy cat ", "data-tags", "Cats, funny,,"}}
+	info := memeOfNode(node)
+	utils.Assert(t, "Grumpy cat", info.Title, "Invalid title")
+	utils.Assert(t, 2, len(info.Tags), "Invalid number of tags")
+	utils.Assert(t, "cats", info.Tags[0], "Tags should be lowercase")
+	utils.Assert(t, "funny", info.Tags[1], "Tags should be trimmed")
+
+	info = memeOfNode(&cdp.Node{Attributes: []string{"alt", "", "title", "Doge"}})
+	utils.Assert(t, "Doge", info.Title, "The title should be used without alt text")
+	utils.Assert(t, 0, len(info.Tags), "Invalid number of tags")
+}
+
+func TestIndexMemesSkipsDuplicates(t *testing.T) {
+	catalogDb := config.CATALOG_DB
+	defer func() {
+		CloseCatalog()
+		catalog = nil
+		config.CATALOG_DB = catalogDb
+	}()
+	config.CATALOG_DB = filepath.Join(t.TempDir(), "catalog.db")
+	if err := OpenCatalog(); err != nil {
+		t.Fatal(err)
+	}
+
+	j := &job{}
+	j.memes.Store("http://a/1.jpg", MemeInfo{Title: "Grumpy cat", Tags: []string{"cats"}})
+	indexMemes(context.Background(), j, []ImageRecord{
+		{Url: "http://a/1.jpg", Sha256: "abc"},
+		{Url: "http://a/2.jpg", DuplicateOf: "http://a/1.jpg"},
+	})
+
+	memes, err := SearchMemes(catalogpkg.Query{Text: "gru"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(t, 1, len(memes), "Invalid number of memes")
+	utils.Assert(t, "abc", memes[0].FileHash, "Invalid file hash")
+	utils.Assert(t, config.SITE_URL, memes[0].Site, "Invalid site")
+	memes, _ = SearchMemes(catalogpkg.Query{})
+	utils.Assert(t, 1, len(memes), "Duplicates shouldn't be indexed")
+}
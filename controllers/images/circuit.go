@@ -0,0 +1,94 @@
+package images
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	config "propper/configs"
+	circuitbreaker "propper/lib/circuitbreaker"
+
+	. "propper/types/errors"
+)
+
+// Circuit breakers of the scraped sites, by host and port.
+var breakers = struct {
+	mu    sync.Mutex
+	hosts map[string]*circuitbreaker.Breaker
+}{hosts: map[string]*circuitbreaker.Breaker{}}
+
+func breakerOf(rawUrl string) *circuitbreaker.Breaker {
+	host := rawUrl
+	if u, err := url.Parse(rawUrl); err == nil {
+		host = strings.ToLower(u.Host)
+	}
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+	breaker, ok := breakers.hosts[host]
+	if !ok {
+		breaker = circuitbreaker.NewBreaker(
+			config.CIRCUIT_BREAKER_FAILURES,
+			time.Duration(config.CIRCUIT_BREAKER_OPEN_TIME)*time.Second,
+			config.CIRCUIT_BREAKER_HALF_OPEN_TRIALS,
+		)
+		breakers.hosts[host] = breaker
+	}
+	return breaker
+}
+
+// Fails fast while the breaker of the site is open.
+func allowSite(breaker *circuitbreaker.Breaker) error {
+	ok, retryAfter := breaker.Allow()
+	if !ok {
+		return &SiteUnavailableError{Err: "The site is failing, try again later", RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// Only connection errors and jobs that run out of the server's TIMEOUT count
+// as failures of the site, as a hanging site is only noticed by its deadline.
+// The deadline of ctx, the context of the client, says nothing about the site,
+// as it can be shorter than any page load or spent waiting for a tab. Successes
+// are jobs that finish, or whose pages loaded without enough images. Any other
+// error, like invalid parameters, robots.txt rules or tabs that can't be
+// opened, and jobs canceled by their client, say nothing about its state.
+func reportSiteResult(ctx context.Context, jobCtx context.Context, breaker *circuitbreaker.Breaker, err error) {
+	if ctx.Err() != nil {
+		breaker.Release()
+		return
+	}
+	if errors.Is(jobCtx.Err(), context.DeadlineExceeded) {
+		breaker.ReportFailure()
+		return
+	}
+	if jobCtx.Err() != nil {
+		breaker.Release()
+		return
+	}
+	if err == nil {
+		breaker.ReportSuccess()
+		return
+	}
+	switch err.(type) {
+	case *ConnectionError:
+		breaker.ReportFailure()
+	case *NotFoundError, *BadRequestError:
+		breaker.ReportSuccess()
+	default:
+		breaker.Release()
+	}
+}
+
+// State of the circuit breaker of every site scraped so far, by host and port.
+func CircuitBreakers() map[string]circuitbreaker.Status {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+	res := map[string]circuitbreaker.Status{}
+	for host, breaker := range breakers.hosts {
+		res[host] = breaker.Status()
+	}
+	return res
+}
@@ -0,0 +1,119 @@
+package images
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	config "propper/configs"
+	circuitbreaker "propper/lib/circuitbreaker"
+	utils "propper/test/utils"
+
+	. "propper/types/errors"
+)
+
+func TestOpenBreakerFailsFast(t *testing.T) {
+	siteUrl, failures, openTime, jobsDir := config.SITE_URL, config.CIRCUIT_BREAKER_FAILURES, config.CIRCUIT_BREAKER_OPEN_TIME, config.JOBS_DIR
+	defer func() {
+		config.SITE_URL, config.CIRCUIT_BREAKER_FAILURES, config.CIRCUIT_BREAKER_OPEN_TIME, config.JOBS_DIR = siteUrl, failures, openTime, jobsDir
+	}()
+	config.SITE_URL = "http://failing.example.com"
+	config.CIRCUIT_BREAKER_FAILURES = 2
+	config.CIRCUIT_BREAKER_OPEN_TIME = 60
+	config.JOBS_DIR = t.TempDir()
+	breaker := breakerOf(config.SITE_URL)
+	for i := 0; i < 2; i += 1 {
+		breaker.Allow()
+		reportSiteResult(context.Background(), context.Background(), breaker, &ConnectionError{Err: "connection refused"})
+	}
+
+	_, err := GetImages(context.Background(), 10, 1)
+	e, ok := err.(*SiteUnavailableError)
+	if !ok {
+		t.Fatal("Expected a site unavailable error, got: ", err)
+	}
+	if e.RetryAfter <= 0 {
+		t.Error("Expected a retry after, got: ", e.RetryAfter)
+	}
+	status := CircuitBreakers()["failing.example.com"]
+	utils.Assert(t, circuitbreaker.Open, status.State, "Invalid breaker state")
+	utils.Assert(t, 2, status.ConsecutiveFailures, "Invalid number of failures")
+}
+
+// Half open breaker of a site, whose next report closes it on success,
+// opens it on failure, and leaves it half open on release.
+func halfOpenBreaker(t *testing.T) *circuitbreaker.Breaker {
+	breaker := circuitbreaker.NewBreaker(1, time.Millisecond, 1)
+	breaker.Allow()
+	breaker.ReportFailure()
+	time.Sleep(5 * time.Millisecond)
+	if ok, _ := breaker.Allow(); !ok {
+		t.Fatal("The breaker should let a trial through")
+	}
+	return breaker
+}
+
+func TestReportSiteResultOfStoppedJobs(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithTimeout(context.Background(), 0)
+	defer cancelExpired()
+
+	breaker := halfOpenBreaker(t)
+	reportSiteResult(canceled, canceled, breaker, &ConnectionError{Err: "canceled"})
+	utils.Assert(t, circuitbreaker.HalfOpen, breaker.Status().State, "Canceled jobs shouldn't be reported")
+
+	breaker = halfOpenBreaker(t)
+	reportSiteResult(expired, expired, breaker, &InternalServerError{Err: "too slow"})
+	utils.Assert(t, circuitbreaker.HalfOpen, breaker.Status().State, "Jobs out of the time of their client shouldn't be reported")
+
+	breaker = halfOpenBreaker(t)
+	reportSiteResult(context.Background(), expired, breaker, &InternalServerError{Err: "too slow"})
+	utils.Assert(t, circuitbreaker.Open, breaker.Status().State, "Jobs out of the server's time should be failures")
+}
+
+func TestClientDeadlinesDontOpenTheBreaker(t *testing.T) {
+	siteUrl, failures, openTime, jobsDir := config.SITE_URL, config.CIRCUIT_BREAKER_FAILURES, config.CIRCUIT_BREAKER_OPEN_TIME, config.JOBS_DIR
+	defer func() {
+		config.SITE_URL, config.CIRCUIT_BREAKER_FAILURES, config.CIRCUIT_BREAKER_OPEN_TIME, config.JOBS_DIR = siteUrl, failures, openTime, jobsDir
+	}()
+	config.SITE_URL = "http://slow-client.example.com"
+	config.CIRCUIT_BREAKER_FAILURES = 2
+	config.CIRCUIT_BREAKER_OPEN_TIME = 60
+	config.JOBS_DIR = t.TempDir()
+	breaker := breakerOf(config.SITE_URL)
+
+	for i := 0; i < 3; i += 1 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+		jobCtx, cancelJob := context.WithTimeout(ctx, time.Minute)
+		breaker.Allow()
+		reportSiteResult(ctx, jobCtx, breaker, &InternalServerError{Err: "Couldn't open a browser tab"})
+		cancelJob()
+		cancel()
+	}
+	status := CircuitBreakers()["slow-client.example.com"]
+	utils.Assert(t, circuitbreaker.Closed, status.State, "Invalid breaker state")
+	utils.Assert(t, 0, status.ConsecutiveFailures, "Invalid number of failures")
+}
+
+func TestReportSiteResult(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected string
+	}{
+		{nil, circuitbreaker.Closed},
+		{&NotFoundError{Err: "no images on the page"}, circuitbreaker.Closed},
+		{&BadRequestError{Err: "not enough images"}, circuitbreaker.Closed},
+		{&ConnectionError{Err: "connection refused"}, circuitbreaker.Open},
+		{&InternalServerError{Err: "Couldn't open a browser tab"}, circuitbreaker.HalfOpen},
+		{&RobotsDisallowedError{Err: "disallowed"}, circuitbreaker.HalfOpen},
+		{&InvalidParametersError{Err: "invalid amount"}, circuitbreaker.HalfOpen},
+	}
+	for _, tc := range cases {
+		breaker := halfOpenBreaker(t)
+		reportSiteResult(context.Background(), context.Background(), breaker, tc.err)
+		utils.Assert(t, tc.expected, breaker.Status().State, fmt.Sprintf("Invalid state after %v", tc.err))
+	}
+}
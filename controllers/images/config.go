@@ -0,0 +1,16 @@
+package images
+
+import (
+	"errors"
+
+	config "propper/configs"
+)
+
+// Rejects the settings that can't be used together. Must be called on
+// startup, the server must not start if it fails.
+func CheckConfig() error {
+	if config.CAPTURE_IMAGES_ON_DISCOVERY && config.BLOCK_IMAGES_ON_DISCOVERY {
+		return errors.New("CAPTURE_IMAGES_ON_DISCOVERY can't be used with BLOCK_IMAGES_ON_DISCOVERY, the blocked images can't be captured")
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package images
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	config "propper/configs"
+)
+
+// Result of one of the readiness checks.
+type Check struct {
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	// values the check is based on, like the free space of the disk
+	Details    map[string]interface{} `json:"details,omitempty"`
+	DurationMs int64                  `json:"duration_ms"`
+}
+
+// Runs the checks a request needs to succeed: a browser answers, the images
+// can be saved, and the tabs aren't so busy that new requests would wait for
+// long. The service is ready when every check is ok.
+func Readiness() (bool, map[string]Check) {
+	checks := map[string]Check{
+		"browser":       timeCheck(checkBrowser),
+		"downloads_dir": timeCheck(checkDownloadsDir),
+		"job_queue":     timeCheck(checkJobQueue),
+	}
+	ready := true
+	for _, check := range checks {
+		ready = ready && check.Ok
+	}
+	return ready, checks
+}
+
+func timeCheck(check func() Check) Check {
+	start := time.Now()
+	res := check()
+	res.DurationMs = time.Since(start).Milliseconds()
+	return res
+}
+
+func failedCheck(err error, details map[string]interface{}) Check {
+	return Check{Ok: false, Error: err.Error(), Details: details}
+}
+
+func checkBrowser() Check {
+	if err := browsers.Ping(time.Duration(config.READY_BROWSER_TIMEOUT) * time.Second); err != nil {
+		return failedCheck(err, nil)
+	}
+	return Check{Ok: true}
+}
+
+func checkDownloadsDir() Check {
+	dir := config.DOWNLOADS_SAVE_DIR
+	file, err := ioutil.TempFile(dir, ".readyz-")
+	if err != nil {
+		return failedCheck(err, nil)
+	}
+	_, err = file.WriteString("ok")
+	file.Close()
+	os.Remove(file.Name())
+	if err != nil {
+		return failedCheck(err, nil)
+	}
+
+	free, err := freeSpace(dir)
+	if err != nil {
+		return failedCheck(err, nil)
+	}
+	minFree := uint64(config.READY_MIN_FREE_SPACE) * 1024 * 1024
+	details := map[string]interface{}{"free_bytes": free, "min_free_bytes": minFree}
+	if free < minFree {
+		return failedCheck(fmt.Errorf("only %d MB free in '%s'", free/1024/1024, dir), details)
+	}
+	return Check{Ok: true, Details: details}
+}
+
+// The queue is saturated when too many pages and downloads are waiting for
+// one of the MAX_TABS tabs.
+func checkJobQueue() Check {
+	waiting := browsers.WaitingTabs()
+	details := map[string]interface{}{
+		"open_tabs":    browsers.OpenTabs(),
+		"max_tabs":     config.MAX_TABS,
+		"waiting_tabs": waiting,
+		"max_waiting":  config.READY_MAX_QUEUED_TABS,
+	}
+	if waiting >= config.READY_MAX_QUEUED_TABS {
+		return failedCheck(fmt.Errorf("%d pages and downloads waiting for a tab", waiting), details)
+	}
+	return Check{Ok: true, Details: details}
+}
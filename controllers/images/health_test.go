@@ -0,0 +1,45 @@
+package images
+
+import (
+	"path/filepath"
+	"testing"
+
+	config "propper/configs"
+	utils "propper/test/utils"
+)
+
+func TestDownloadsDirCheck(t *testing.T) {
+	saveDir, minFree := config.DOWNLOADS_SAVE_DIR, config.READY_MIN_FREE_SPACE
+	defer func() {
+		config.DOWNLOADS_SAVE_DIR, config.READY_MIN_FREE_SPACE = saveDir, minFree
+	}()
+	config.DOWNLOADS_SAVE_DIR = t.TempDir()
+	config.READY_MIN_FREE_SPACE = 0
+
+	check := checkDownloadsDir()
+	utils.Assert(t, true, check.Ok, "Writable directory should be ok")
+	matches, _ := filepath.Glob(filepath.Join(config.DOWNLOADS_SAVE_DIR, "*"))
+	utils.Assert(t, 0, len(matches), "The test file should be removed")
+
+	config.DOWNLOADS_SAVE_DIR = filepath.Join(t.TempDir(), "missing")
+	check = checkDownloadsDir()
+	utils.Assert(t, false, check.Ok, "Missing directory shouldn't be ok")
+
+	config.DOWNLOADS_SAVE_DIR = t.TempDir()
+	config.READY_MIN_FREE_SPACE = 1 << 40
+	check = checkDownloadsDir()
+	utils.Assert(t, false, check.Ok, "Directory without enough free space shouldn't be ok")
+	if check.Details["free_bytes"] == nil {
+		t.Error("Expected the free space in the details")
+	}
+}
+
+func TestJobQueueCheck(t *testing.T) {
+	maxQueued := config.READY_MAX_QUEUED_TABS
+	defer func() { config.READY_MAX_QUEUED_TABS = maxQueued }()
+
+	config.READY_MAX_QUEUED_TABS = 1
+	utils.Assert(t, true, checkJobQueue().Ok, "Queue without waiting tabs should be ok")
+	config.READY_MAX_QUEUED_TABS = 0
+	utils.Assert(t, false, checkJobQueue().Ok, "Queue at its limit shouldn't be ok")
+}
@@ -0,0 +1,107 @@
+package images
+
+import (
+	"context"
+	"time"
+
+	config "propper/configs"
+	jobstore "propper/lib/jobstore"
+	logger "propper/lib/logger"
+
+	. "propper/types/errors"
+)
+
+// History of every job, nil until OpenHistory is called. Jobs aren't
+// recorded without it.
+var history *jobstore.Store
+
+// Opens the history of the jobs in JOBS_DB. Must be called on startup, before any job starts.
+func OpenHistory() error {
+	store, err := jobstore.Open(config.JOBS_DB)
+	if err != nil {
+		return err
+	}
+	history = store
+	return nil
+}
+
+func CloseHistory() {
+	if history == nil {
+		return
+	}
+	if err := history.Close(); err != nil {
+		logger.Error(context.Background(), "Couldn't close the history of the jobs", "error", err)
+	}
+}
+
+func recordJob(ctx context.Context, rj *runningJob, status string, err error) {
+	rj.mu.Lock()
+	state := rj.state
+	state.Images = append([]ImageRecord{}, rj.state.Images...)
+	rj.mu.Unlock()
+	recordState(ctx, &state, status, err)
+}
+
+// Saves in the history the job with the state, status and error. Jobs that
+// aren't running get their finish time.
+func recordState(ctx context.Context, state *JobState, status string, err error) {
+	if history == nil {
+		return
+	}
+	record := &jobstore.Record{
+		ID:        state.ID,
+		Site:      state.Site,
+		Status:    status,
+		Amount:    state.Amount,
+		Threads:   state.Threads,
+		StartedAt: state.StartedAt,
+		Resumes:   state.Resumes,
+		Directory: state.Directory,
+		Images:    []jobstore.Image{},
+	}
+	if status != JobRunning {
+		finishedAt := time.Now().UTC()
+		if state.InterruptedAt != nil {
+			finishedAt = *state.InterruptedAt
+		}
+		record.FinishedAt = &finishedAt
+	}
+	if err != nil {
+		record.Error = err.Error()
+		record.ErrorType = errorType(err)
+	}
+	if state.Concurrency != nil {
+		record.Concurrency = &jobstore.Concurrency{
+			Initial: state.Concurrency.Initial,
+			Final:   state.Concurrency.Final,
+			Peak:    state.Concurrency.Peak,
+		}
+	}
+	for _, image := range state.Images {
+		record.Images = append(record.Images, jobstore.Image{
+			Url:         image.Url,
+			File:        image.File,
+			Hashes:      image.Hashes,
+			DuplicateOf: image.DuplicateOf,
+			Proxy:       image.Proxy,
+		})
+	}
+	if err := history.Put(record); err != nil {
+		logger.Warn(ctx, "Couldn't save the job in the history", "error", err)
+	}
+}
+
+// Jobs matching the filter, the newest first. See jobstore.Store.List for the cursor.
+func ListJobs(filter jobstore.Filter, limit int, cursor string) ([]jobstore.Record, string, error) {
+	if history == nil {
+		return nil, "", &InternalServerError{Err: "The history of the jobs isn't open"}
+	}
+	records, next, err := history.List(filter, limit, cursor)
+	if err == jobstore.ErrInvalidCursor {
+		return nil, "", &InvalidParametersError{Err: "Invalid 'cursor' parameter"}
+	}
+	if err != nil {
+		return nil, "", &InternalServerError{Err: "Unexpected error reading the history of the jobs", RawError: err}
+	}
+	return records, next, nil
+}
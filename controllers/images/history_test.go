@@ -0,0 +1,65 @@
+package images
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	config "propper/configs"
+	concurrency "propper/lib/concurrency"
+	jobstore "propper/lib/jobstore"
+	utils "propper/test/utils"
+
+	. "propper/types/errors"
+)
+
+func TestJobsAreRecordedInTheHistory(t *testing.T) {
+	jobsDir, jobsDB := config.JOBS_DIR, config.JOBS_DB
+	config.JOBS_DIR = t.TempDir()
+	config.JOBS_DB = filepath.Join(t.TempDir(), "jobs.db")
+	if err := OpenHistory(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		CloseHistory()
+		history = nil
+		config.JOBS_DIR, config.JOBS_DB = jobsDir, jobsDB
+	}()
+
+	started := time.Now().UTC()
+	ctx, rj, _ := startJob(context.Background(), JobState{ID: "ok", Site: "http://a.com", Amount: 1, Threads: 1, StartedAt: started})
+	records, _, _ := ListJobs(jobstore.Filter{Status: JobRunning}, 10, "")
+	utils.Assert(t, 1, len(records), "Running job should be recorded")
+	rj.imageDone(ctx, ImageRecord{Url: "http://a.com/1.jpg", File: "1.jpg"})
+	rj.setConcurrency(concurrency.Stats{Initial: 1, Final: 2, Peak: 3})
+	finishJob(ctx, rj, nil)
+
+	ctx, rj, _ = startJob(context.Background(), JobState{ID: "ko", Site: "http://b.com", Amount: 1, Threads: 1, StartedAt: started.Add(time.Second)})
+	finishJob(ctx, rj, &NotFoundError{Err: "no images"})
+
+	records, _, err := ListJobs(jobstore.Filter{}, 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(t, 2, len(records), "Invalid number of jobs")
+	failed, finished := records[0], records[1]
+	utils.Assert(t, JobFailed, failed.Status, "Invalid status of the failed job")
+	utils.Assert(t, "NotFoundError", failed.ErrorType, "Invalid error type")
+	utils.Assert(t, JobFinished, finished.Status, "Invalid status of the finished job")
+	utils.Assert(t, 1, len(finished.Images), "Invalid number of images")
+	if utils.Assert(t, true, finished.Concurrency != nil, "Expected the concurrency of the finished job") {
+		utils.Assert(t, jobstore.Concurrency{Initial: 1, Final: 2, Peak: 3}, *finished.Concurrency, "Invalid concurrency")
+	}
+	utils.Assert(t, true, failed.Concurrency == nil, "The pages of the failed job weren't queried")
+	if finished.FinishedAt == nil {
+		t.Error("Expected the finish time")
+	}
+
+	records, _, _ = ListJobs(jobstore.Filter{ImageUrl: "http://a.com/1.jpg"}, 10, "")
+	utils.Assert(t, 1, len(records), "Invalid number of jobs that fetched the image")
+	_, _, err = ListJobs(jobstore.Filter{}, 10, "zz")
+	if _, ok := err.(*InvalidParametersError); !ok {
+		t.Error("Expected an invalid parameters error for an invalid cursor, got: ", err)
+	}
+}
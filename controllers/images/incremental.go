@@ -0,0 +1,75 @@
+package images
+
+import (
+	"fmt"
+	"time"
+
+	config "propper/configs"
+	catalogpkg "propper/lib/catalog"
+	jobstore "propper/lib/jobstore"
+
+	. "propper/types/errors"
+)
+
+// Time from which the memes of the site are new. since is `last`, for the
+// end of the last finished job of the site, the id of a job, for its end,
+// or a date or RFC 3339 time. Without previous jobs every meme is new.
+func resolveSince(since string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse("2006-01-02", since); err == nil {
+		return t, nil
+	}
+	if since != "last" && !jobIDPattern.MatchString(since) {
+		return time.Time{}, &InvalidParametersError{Err: "since must be last, the id of a job, a date or a RFC 3339 time."}
+	}
+	if history == nil {
+		return time.Time{}, &InternalServerError{Err: "The history of the jobs isn't open"}
+	}
+	if since == "last" {
+		records, _, err := history.List(jobstore.Filter{Status: JobFinished, Site: config.SITE_URL}, 1, "")
+		if err != nil {
+			return time.Time{}, &InternalServerError{Err: "Unexpected error reading the history of the jobs", RawError: err}
+		}
+		if len(records) == 0 {
+			return time.Time{}, nil
+		}
+		return *records[0].FinishedAt, nil
+	}
+	record, err := history.Get(since)
+	if err == jobstore.ErrNotFound {
+		return time.Time{}, &NotFoundError{Err: fmt.Sprintf("There is no job with id %s", since)}
+	}
+	if err != nil {
+		return time.Time{}, &InternalServerError{Err: "Unexpected error reading the history of the jobs", RawError: err}
+	}
+	if record.Site != config.SITE_URL {
+		return time.Time{}, &InvalidParametersError{Err: fmt.Sprintf("The job %s scraped %s, not the current site", since, record.Site)}
+	}
+	if record.FinishedAt == nil {
+		return time.Time{}, &InvalidParametersError{Err: fmt.Sprintf("The job %s is still running", since)}
+	}
+	return *record.FinishedAt, nil
+}
+
+// Index of the first url found in the catalog before since, or -1 if every
+// url is new.
+func firstSeenBefore(since time.Time, urls []string) (int, error) {
+	if catalog == nil {
+		return -1, &InternalServerError{Err: "The catalog isn't open"}
+	}
+	for i, url := range urls {
+		entry, err := catalog.Get(url)
+		if err == catalogpkg.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return -1, &InternalServerError{Err: "Unexpected error reading the catalog", RawError: err}
+		}
+		if !entry.FirstSeen.After(since) {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
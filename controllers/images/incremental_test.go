@@ -0,0 +1,83 @@
+package images
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	config "propper/configs"
+	catalogpkg "propper/lib/catalog"
+	jobstore "propper/lib/jobstore"
+	utils "propper/test/utils"
+
+	. "propper/types/errors"
+)
+
+func TestResolveSince(t *testing.T) {
+	jobsDB := config.JOBS_DB
+	config.JOBS_DB = filepath.Join(t.TempDir(), "jobs.db")
+	if err := OpenHistory(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		CloseHistory()
+		history = nil
+		config.JOBS_DB = jobsDB
+	}()
+
+	since, err := resolveSince("last")
+	utils.Assert(t, nil, err, "Without jobs since shouldn't fail")
+	utils.Assert(t, true, since.IsZero(), "Without jobs every meme should be new")
+
+	started := time.Date(2022, 1, 3, 10, 0, 0, 0, time.UTC)
+	finished := started.Add(time.Minute)
+	history.Put(&jobstore.Record{ID: "aa", Site: config.SITE_URL, Status: JobFinished, StartedAt: started, FinishedAt: &finished})
+	history.Put(&jobstore.Record{ID: "bb", Site: config.SITE_URL, Status: JobRunning, StartedAt: started.Add(time.Hour)})
+	history.Put(&jobstore.Record{ID: "cc", Site: "http://other.com", Status: JobFinished, StartedAt: started.Add(time.Hour), FinishedAt: &finished})
+
+	since, _ = resolveSince("last")
+	utils.Assert(t, finished, since, "Invalid since of the last job")
+	since, _ = resolveSince("aa")
+	utils.Assert(t, finished, since, "Invalid since of a job")
+	since, _ = resolveSince("2022-01-02")
+	utils.Assert(t, time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC), since, "Invalid since of a date")
+
+	_, err = resolveSince("dd")
+	if _, ok := err.(*NotFoundError); !ok {
+		t.Error("Expected a not found error for a missing job, got: ", err)
+	}
+	for _, value := range []string{"bb", "cc", "yesterday"} {
+		_, err := resolveSince(value)
+		if _, ok := err.(*InvalidParametersError); !ok {
+			t.Error("Expected an invalid parameters error for ", value, ", got: ", err)
+		}
+	}
+}
+
+func TestFirstSeenBefore(t *testing.T) {
+	catalogDb := config.CATALOG_DB
+	config.CATALOG_DB = filepath.Join(t.TempDir(), "catalog.db")
+	if err := OpenCatalog(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		CloseCatalog()
+		catalog = nil
+		config.CATALOG_DB = catalogDb
+	}()
+
+	monday := time.Date(2022, 1, 3, 0, 0, 0, 0, time.UTC)
+	catalog.Add([]catalogpkg.Entry{{Url: "http://a/old.jpg"}}, monday)
+	catalog.Add([]catalogpkg.Entry{{Url: "http://a/new.jpg"}}, monday.Add(48*time.Hour))
+	urls := []string{"http://a/unknown.jpg", "http://a/new.jpg", "http://a/old.jpg", "http://a/older.jpg"}
+
+	i, err := firstSeenBefore(monday.Add(24*time.Hour), urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(t, 2, i, "Invalid index of the first seen meme")
+	i, _ = firstSeenBefore(monday.Add(-time.Hour), urls)
+	utils.Assert(t, -1, i, "Every meme should be new")
+	i, _ = firstSeenBefore(monday.Add(72*time.Hour), urls)
+	utils.Assert(t, 1, i, "Invalid index of the first seen meme")
+}
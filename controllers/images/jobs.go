@@ -0,0 +1,409 @@
+package images
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	config "propper/configs"
+	concurrency "propper/lib/concurrency"
+	logger "propper/lib/logger"
+
+	. "propper/types/errors"
+)
+
+// Status of the jobs saved in JOBS_DIR
+const (
+	JobRunning     = "running"
+	JobInterrupted = "interrupted"
+	// only kept in the history of the jobs
+	JobFinished = "finished"
+	JobFailed   = "failed"
+)
+
+// Checkpoint of a job, saved in JOBS_DIR while it runs. It's removed when the
+// job ends, unless it's interrupted by a shutdown or a crash, so the job can
+// be resumed without scraping the same pages or downloading the same images.
+type JobState struct {
+	ID            string     `json:"id"`
+	Site          string     `json:"site"`
+	Amount        int        `json:"amount"`
+	Threads       int        `json:"threads"`
+	Status        string     `json:"status"`
+	StartedAt     time.Time  `json:"started_at"`
+	InterruptedAt *time.Time `json:"interrupted_at,omitempty"`
+	Resumes       int        `json:"resumes,omitempty"`
+	// only the memes first seen after it are scraped, nil to scrape every meme
+	Since *time.Time `json:"since,omitempty"`
+	// urls found on each scraped page
+	Pages map[int][]string `json:"pages,omitempty"`
+	// title and tags of the images found on the scraped pages, by url
+	Memes map[string]MemeInfo `json:"memes,omitempty"`
+	// directory of the images, once created
+	Directory string `json:"directory,omitempty"`
+	// images already saved in Directory
+	Images []ImageRecord `json:"images,omitempty"`
+	// threads used to query the pages, once they are queried
+	Concurrency *concurrency.Stats `json:"concurrency,omitempty"`
+}
+
+type runningJob struct {
+	cancel context.CancelFunc
+	// canceled by CancelJobs, instead of by its request
+	interrupted bool
+
+	// guards the state, updated by the stages of the job
+	mu        sync.Mutex
+	state     JobState
+	lastSaved time.Time
+}
+
+// Jobs being processed, so the server can wait for them or stop them when
+// shutting down. Once stopping, new jobs are refused.
+var runningJobs = struct {
+	sync.Mutex
+	jobs     map[string]*runningJob
+	stopping bool
+	wg       sync.WaitGroup
+}{jobs: map[string]*runningJob{}}
+
+// Registers the job, returning the context it must run with, which is
+// canceled by CancelJobs. Fails if the server is shutting down, or if the
+// job is already running.
+func startJob(ctx context.Context, state JobState) (context.Context, *runningJob, error) {
+	runningJobs.Lock()
+	if runningJobs.stopping {
+		runningJobs.Unlock()
+		return nil, nil, &ShuttingDownError{Err: "The server is shutting down and doesn't accept new jobs"}
+	}
+	if _, ok := runningJobs.jobs[state.ID]; ok {
+		runningJobs.Unlock()
+		return nil, nil, &InvalidParametersError{Err: fmt.Sprintf("The job %s is already running", state.ID)}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	state.Status = JobRunning
+	state.InterruptedAt = nil
+	rj := &runningJob{state: state, cancel: cancel}
+	runningJobs.jobs[state.ID] = rj
+	runningJobs.wg.Add(1)
+	runningJobs.Unlock()
+
+	rj.checkpoint(ctx, true)
+	recordJob(ctx, rj, JobRunning, nil)
+	return ctx, rj, nil
+}
+
+// Unregisters the job. If it was interrupted its state is kept, and err is
+// replaced by the interruption. Otherwise its state is removed.
+func finishJob(ctx context.Context, rj *runningJob, err error) error {
+	runningJobs.Lock()
+	delete(runningJobs.jobs, rj.state.ID)
+	interrupted := rj.interrupted && err != nil
+	runningJobs.Unlock()
+	defer runningJobs.wg.Done()
+	rj.cancel()
+	if !interrupted {
+		if removeErr := os.Remove(jobStatePath(rj.state.ID)); removeErr != nil && !os.IsNotExist(removeErr) {
+			logger.Warn(ctx, "Couldn't remove the state of the job", "error", removeErr)
+		}
+		if err != nil {
+			recordJob(ctx, rj, JobFailed, err)
+		} else {
+			recordJob(ctx, rj, JobFinished, nil)
+		}
+		return err
+	}
+
+	now := time.Now().UTC()
+	rj.mu.Lock()
+	rj.state.Status = JobInterrupted
+	rj.state.InterruptedAt = &now
+	rj.mu.Unlock()
+	rj.checkpoint(ctx, true)
+	err = &ShuttingDownError{Err: fmt.Sprintf("The job %s was interrupted by a shutdown, resume it with its id", rj.state.ID)}
+	recordJob(ctx, rj, JobInterrupted, err)
+	return err
+}
+
+// Saves the state of the job, at most once every CHECKPOINT_INTERVAL unless
+// forced. A crash loses the progress since the last save. Safe to call on
+// nil, for the stages run without a job.
+func (rj *runningJob) checkpoint(ctx context.Context, force bool) {
+	if rj == nil {
+		return
+	}
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+	interval := time.Duration(config.CHECKPOINT_INTERVAL) * time.Millisecond
+	if !force && time.Since(rj.lastSaved) < interval {
+		return
+	}
+	if err := saveJobState(&rj.state); err != nil {
+		logger.Warn(ctx, "Couldn't save the state of the job", "error", err)
+		return
+	}
+	rj.lastSaved = time.Now()
+}
+
+// Urls found on the pages scraped before resuming the job.
+func (rj *runningJob) pages() map[int][]string {
+	res := map[int][]string{}
+	if rj == nil {
+		return res
+	}
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+	for page, urls := range rj.state.Pages {
+		res[page] = urls
+	}
+	return res
+}
+
+func (rj *runningJob) hasPage(page int) bool {
+	if rj == nil {
+		return false
+	}
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+	_, ok := rj.state.Pages[page]
+	return ok
+}
+
+// Title and tags of the images found on the pages scraped before resuming the job.
+func (rj *runningJob) memes() map[string]MemeInfo {
+	res := map[string]MemeInfo{}
+	if rj == nil {
+		return res
+	}
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+	for url, info := range rj.state.Memes {
+		res[url] = info
+	}
+	return res
+}
+
+func (rj *runningJob) pageDone(ctx context.Context, page int, urls []string, memes map[string]MemeInfo) {
+	if rj == nil {
+		return
+	}
+	rj.mu.Lock()
+	if rj.state.Pages == nil {
+		rj.state.Pages = map[int][]string{}
+	}
+	rj.state.Pages[page] = urls
+	if rj.state.Memes == nil {
+		rj.state.Memes = map[string]MemeInfo{}
+	}
+	for url, info := range memes {
+		rj.state.Memes[url] = info
+	}
+	rj.mu.Unlock()
+	rj.checkpoint(ctx, false)
+}
+
+func (rj *runningJob) setConcurrency(stats concurrency.Stats) {
+	if rj == nil {
+		return
+	}
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+	rj.state.Concurrency = &stats
+}
+
+// Directory the images of the job are saved in, or "" if it isn't created yet.
+func (rj *runningJob) directory() string {
+	if rj == nil {
+		return ""
+	}
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+	return rj.state.Directory
+}
+
+func (rj *runningJob) setDirectory(ctx context.Context, path string) {
+	if rj == nil {
+		return
+	}
+	rj.mu.Lock()
+	rj.state.Directory = path
+	rj.mu.Unlock()
+	rj.checkpoint(ctx, true)
+}
+
+// Record of the image if it was saved before resuming the job, and its file is still there.
+func (rj *runningJob) image(url string) (ImageRecord, bool) {
+	if rj == nil {
+		return ImageRecord{}, false
+	}
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+	for _, record := range rj.state.Images {
+		if record.Url == url {
+			_, err := os.Stat(filepath.Join(rj.state.Directory, record.File))
+			return record, err == nil
+		}
+	}
+	return ImageRecord{}, false
+}
+
+// Number of images saved before resuming the job.
+func (rj *runningJob) imagesCount() int {
+	if rj == nil {
+		return 0
+	}
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+	return len(rj.state.Images)
+}
+
+// Replaces the images of the job by the final ones, once the near duplicates are dropped.
+func (rj *runningJob) setImages(records []ImageRecord) {
+	if rj == nil {
+		return
+	}
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+	rj.state.Images = append([]ImageRecord{}, records...)
+}
+
+func (rj *runningJob) imageDone(ctx context.Context, record ImageRecord) {
+	if rj == nil {
+		return
+	}
+	rj.mu.Lock()
+	rj.state.Images = append(rj.state.Images, record)
+	rj.mu.Unlock()
+	rj.checkpoint(ctx, false)
+}
+
+var jobIDPattern = regexp.MustCompile(`^[0-9a-f]+$`)
+
+func jobStatePath(id string) string {
+	return filepath.Join(config.JOBS_DIR, id+".json")
+}
+
+func loadJobState(id string) (*JobState, error) {
+	payload, err := ioutil.ReadFile(jobStatePath(id))
+	if err != nil {
+		return nil, err
+	}
+	state := &JobState{}
+	if err := json.Unmarshal(payload, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func saveJobState(state *JobState) error {
+	if err := os.MkdirAll(config.JOBS_DIR, 0755); err != nil {
+		return err
+	}
+	payload, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	// written aside and renamed, so a crash never leaves a partial file
+	tmpPath := jobStatePath(state.ID) + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, payload, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, jobStatePath(state.ID))
+}
+
+// New jobs fail with a ShuttingDownError from now on.
+func StopAcceptingJobs() {
+	runningJobs.Lock()
+	defer runningJobs.Unlock()
+	runningJobs.stopping = true
+}
+
+// Cancels the running jobs, which are saved as interrupted. Returns how many were canceled.
+func CancelJobs() int {
+	runningJobs.Lock()
+	defer runningJobs.Unlock()
+	for _, rj := range runningJobs.jobs {
+		rj.interrupted = true
+		rj.cancel()
+	}
+	return len(runningJobs.jobs)
+}
+
+// Waits until every running job finishes, or ctx is done. Must be called
+// after StopAcceptingJobs, so no job starts while waiting.
+func WaitJobs(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		runningJobs.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Marks as interrupted the jobs left running by a crash. Must be called on
+// startup, before any job starts.
+func RecoverJobs() error {
+	paths, err := filepath.Glob(filepath.Join(config.JOBS_DIR, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		state, err := loadJobState(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			logger.Warn(context.Background(), "Invalid job state", "file", path, "error", err)
+			continue
+		}
+		if state.Status != JobRunning {
+			continue
+		}
+		// the last checkpoint is the closest to the crash we know of
+		if info, err := os.Stat(path); err == nil {
+			interruptedAt := info.ModTime().UTC()
+			state.InterruptedAt = &interruptedAt
+		}
+		state.Status = JobInterrupted
+		if err := saveJobState(state); err != nil {
+			return err
+		}
+		recordState(context.Background(), state, JobInterrupted, nil)
+		logger.Info(context.Background(), "Job interrupted by a crash can be resumed", "job_id", state.ID)
+	}
+	return nil
+}
+
+// Resumes a job interrupted by a shutdown or a crash, with the same id and
+// parameters. The pages already scraped and the images already saved are
+// reused. Returns the urls of all the images of the job.
+func ResumeJob(ctx context.Context, id string) ([]string, error) {
+	// the id becomes a file name
+	if !jobIDPattern.MatchString(id) {
+		return nil, &NotFoundError{Err: fmt.Sprintf("There is no interrupted job with id %s", id)}
+	}
+	state, err := loadJobState(id)
+	if os.IsNotExist(err) {
+		return nil, &NotFoundError{Err: fmt.Sprintf("There is no interrupted job with id %s", id)}
+	}
+	if err != nil {
+		return nil, &InternalServerError{Err: "Unexpected error reading the state of the job", RawError: err}
+	}
+	if state.Status != JobInterrupted {
+		return nil, &InvalidParametersError{Err: fmt.Sprintf("The job %s wasn't interrupted, its status is %s", id, state.Status)}
+	}
+	if state.Site != config.SITE_URL {
+		return nil, &InvalidParametersError{Err: fmt.Sprintf("The job %s scraped %s, not the current site", id, state.Site)}
+	}
+	state.Resumes += 1
+	return runJob(ctx, *state)
+}
@@ -0,0 +1,138 @@
+package images
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	config "propper/configs"
+	utils "propper/test/utils"
+
+	. "propper/types/errors"
+)
+
+func TestCancelJobsSavesInterruptedJobs(t *testing.T) {
+	jobsDir := config.JOBS_DIR
+	defer func() { config.JOBS_DIR = jobsDir }()
+	config.JOBS_DIR = t.TempDir()
+
+	ctx, rj, err := startJob(context.Background(), JobState{ID: "abc", Amount: 10, Threads: 2, StartedAt: time.Now().UTC()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(t, 1, CancelJobs(), "Invalid number of canceled jobs")
+	<-ctx.Done()
+	err = finishJob(ctx, rj, contextError(ctx, ctx.Err()))
+	if _, ok := err.(*ShuttingDownError); !ok {
+		t.Fatal("Expected a shutting down error, got: ", err)
+	}
+
+	payload, err := ioutil.ReadFile(jobStatePath("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := JobState{}
+	if err := json.Unmarshal(payload, &state); err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(t, JobInterrupted, state.Status, "Invalid status")
+	utils.Assert(t, 10, state.Amount, "Invalid amount")
+	if state.InterruptedAt == nil {
+		t.Error("Expected the time of the interruption")
+	}
+	waitCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	utils.Assert(t, nil, WaitJobs(waitCtx), "Jobs should be finished")
+}
+
+func TestFinishedJobsAreNotSaved(t *testing.T) {
+	jobsDir := config.JOBS_DIR
+	defer func() { config.JOBS_DIR = jobsDir }()
+	config.JOBS_DIR = t.TempDir()
+
+	ctx, rj, err := startJob(context.Background(), JobState{ID: "done"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(t, nil, finishJob(ctx, rj, nil), "Finished job shouldn't fail")
+	utils.Assert(t, 0, CancelJobs(), "Finished jobs shouldn't be canceled")
+	files, _ := ioutil.ReadDir(config.JOBS_DIR)
+	utils.Assert(t, 0, len(files), "Finished jobs shouldn't be saved")
+}
+
+func TestRefuseJobsWhenStopping(t *testing.T) {
+	defer func() {
+		runningJobs.Lock()
+		runningJobs.stopping = false
+		runningJobs.Unlock()
+	}()
+	StopAcceptingJobs()
+	_, _, err := startJob(context.Background(), JobState{ID: "late"})
+	if _, ok := err.(*ShuttingDownError); !ok {
+		t.Fatal("Expected a shutting down error, got: ", err)
+	}
+}
+
+func TestRecoverJobsLeftRunning(t *testing.T) {
+	jobsDir := config.JOBS_DIR
+	defer func() { config.JOBS_DIR = jobsDir }()
+	config.JOBS_DIR = t.TempDir()
+
+	saveJobState(&JobState{ID: "aa", Site: config.SITE_URL, Status: JobRunning, Pages: map[int][]string{1: {"http://a/1.jpg"}}})
+	if err := RecoverJobs(); err != nil {
+		t.Fatal(err)
+	}
+	state, err := loadJobState("aa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(t, JobInterrupted, state.Status, "Invalid status")
+	utils.Assert(t, 1, len(state.Pages[1]), "The checkpoint should be kept")
+	if state.InterruptedAt == nil {
+		t.Error("Expected the time of the interruption")
+	}
+}
+
+func TestResumeOnlyInterruptedJobs(t *testing.T) {
+	jobsDir := config.JOBS_DIR
+	defer func() { config.JOBS_DIR = jobsDir }()
+	config.JOBS_DIR = t.TempDir()
+
+	_, err := ResumeJob(context.Background(), "bb")
+	if _, ok := err.(*NotFoundError); !ok {
+		t.Error("Expected a not found error for a missing job, got: ", err)
+	}
+	_, err = ResumeJob(context.Background(), "../bb")
+	if _, ok := err.(*NotFoundError); !ok {
+		t.Error("Expected a not found error for an invalid id, got: ", err)
+	}
+	saveJobState(&JobState{ID: "cc", Site: config.SITE_URL, Status: JobRunning})
+	_, err = ResumeJob(context.Background(), "cc")
+	if _, ok := err.(*InvalidParametersError); !ok {
+		t.Error("Expected an invalid parameters error for a running job, got: ", err)
+	}
+}
+
+func TestMemesAreKeptForResumedJobs(t *testing.T) {
+	jobsDir := config.JOBS_DIR
+	defer func() { config.JOBS_DIR = jobsDir }()
+	config.JOBS_DIR = t.TempDir()
+
+	rj := &runningJob{state: JobState{ID: "dd", Site: config.SITE_URL, Status: JobRunning}}
+	rj.pageDone(context.Background(), 1, []string{"http://a/1.jpg"}, map[string]MemeInfo{
+		"http://a/1.jpg": {Title: "Grumpy cat", Tags: []string{"cats"}},
+	})
+	state, err := loadJobState("dd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed := &runningJob{state: *state}
+	info, ok := resumed.memes()["http://a/1.jpg"]
+	if !utils.Assert(t, true, ok, "The memes of the scraped pages should be saved") {
+		return
+	}
+	utils.Assert(t, "Grumpy cat", info.Title, "Invalid title")
+	utils.Assert(t, 1, len(info.Tags), "Invalid number of tags")
+}
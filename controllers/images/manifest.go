@@ -0,0 +1,156 @@
+package images
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	config "propper/configs"
+	concurrency "propper/lib/concurrency"
+	imagehash "propper/lib/imagehash"
+	logger "propper/lib/logger"
+
+	. "propper/types/errors"
+)
+
+const manifestFileName = "manifest.json"
+
+type ImageRecord struct {
+	Url         string            `json:"url"`
+	File        string            `json:"file,omitempty"`
+	Hashes      *imagehash.Hashes `json:"hashes,omitempty"`
+	DuplicateOf string            `json:"duplicate_of,omitempty"`
+	// proxy the image was downloaded through
+	Proxy string `json:"proxy,omitempty"`
+	// of the file, to find the same image in other downloads
+	Sha256 string `json:"sha256,omitempty"`
+}
+
+// Summary of a download, saved next to the images.
+type Manifest struct {
+	CreatedAt time.Time `json:"created_at"`
+	Site      string    `json:"site"`
+	// threads used to query the pages
+	Concurrency *concurrency.Stats `json:"concurrency,omitempty"`
+	Images      []ImageRecord      `json:"images"`
+}
+
+type SimilarImage struct {
+	Url       string `json:"url"`
+	File      string `json:"file"`
+	Directory string `json:"directory"`
+	Distance  int    `json:"distance"`
+}
+
+func writeManifest(path string, manifest *Manifest) error {
+	payload, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return &InternalServerError{Err: "Unexpected error encoding manifest.", RawError: err}
+	}
+	if err := ioutil.WriteFile(fmt.Sprintf("%s/%s", path, manifestFileName), payload, 0644); err != nil {
+		return &InternalServerError{Err: "Unexpected error writing manifest locally.", RawError: err}
+	}
+	return nil
+}
+
+func readManifest(path string) (*Manifest, error) {
+	payload, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", path, manifestFileName))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(payload, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Marks as duplicated every image whose perceptual hash is within
+// NEAR_DUPLICATE_DISTANCE of a previous image, and removes its file. Returns
+// the number of images dropped, which aren't replaced by new ones.
+func dropNearDuplicates(ctx context.Context, path string, records []ImageRecord) int {
+	dropped := 0
+	kept := []ImageRecord{}
+	for i := range records {
+		record := &records[i]
+		if record.Hashes == nil {
+			continue
+		}
+		for _, original := range kept {
+			if imagehash.Distance(original.Hashes.PHash, record.Hashes.PHash) <= config.NEAR_DUPLICATE_DISTANCE {
+				record.DuplicateOf = original.Url
+				break
+			}
+		}
+		if len(record.DuplicateOf) == 0 {
+			kept = append(kept, *record)
+			continue
+		}
+		dropped += 1
+		logger.Debug(ctx, "Near duplicate image dropped", "url", record.Url, "duplicate_of", record.DuplicateOf)
+		if err := os.Remove(fmt.Sprintf("%s/%s", path, record.File)); err != nil {
+			logger.Warn(ctx, "Couldn't remove near duplicate image", "file", record.File, "error", err)
+		}
+		record.File = ""
+	}
+	return dropped
+}
+
+func selectHash(hashes *imagehash.Hashes, algorithm string) (imagehash.Hash, error) {
+	switch algorithm {
+	case "ahash":
+		return hashes.AHash, nil
+	case "dhash":
+		return hashes.DHash, nil
+	case "phash":
+		return hashes.PHash, nil
+	}
+	return 0, &InvalidParametersError{Err: "algorithm must be one of 'ahash', 'dhash' or 'phash'."}
+}
+
+// Looks in every stored download for images whose hash of the given algorithm
+// is at most maxDistance bits away from hash. Results are sorted by distance.
+func FindSimilarImages(hash string, algorithm string, maxDistance int) ([]SimilarImage, error) {
+	target, err := imagehash.ParseHash(hash)
+	if err != nil {
+		return nil, &InvalidParametersError{Err: err.Error()}
+	}
+	if _, err := selectHash(&imagehash.Hashes{}, algorithm); err != nil {
+		return nil, err
+	}
+
+	dirs, err := os.ReadDir(config.DOWNLOADS_SAVE_DIR)
+	if err != nil {
+		return nil, &InternalServerError{Err: "Unexpected error reading downloads directory.", RawError: err}
+	}
+	res := []SimilarImage{}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		manifest, err := readManifest(fmt.Sprintf("%s/%s", config.DOWNLOADS_SAVE_DIR, dir.Name()))
+		if err != nil {
+			// downloads made before manifests existed
+			continue
+		}
+		for _, record := range manifest.Images {
+			if record.Hashes == nil || len(record.File) == 0 {
+				continue
+			}
+			imageHash, _ := selectHash(record.Hashes, algorithm)
+			distance := imagehash.Distance(target, imageHash)
+			if distance > maxDistance {
+				continue
+			}
+			res = append(res, SimilarImage{Url: record.Url, File: record.File, Directory: dir.Name(), Distance: distance})
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Distance < res[j].Distance
+	})
+	return res, nil
+}
@@ -0,0 +1,76 @@
+package images
+
+import (
+	"reflect"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	config "propper/configs"
+)
+
+var (
+	pagesScraped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "propper_pages_scraped_total",
+		Help: "Pages of the site scraped looking for images.",
+	})
+	imagesDownloaded = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "propper_images_downloaded_total",
+		Help: "Images saved to disk.",
+	})
+	bytesWritten = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "propper_bytes_written_total",
+		Help: "Bytes of the images saved to disk.",
+	})
+	jobErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "propper_errors_total",
+		Help: "Requests failed, by type of error.",
+	}, []string{"type"})
+	jobsRunning = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "propper_jobs_running",
+		Help: "Requests being processed.",
+	})
+	pagesInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "propper_pages_in_flight",
+		Help: "Pages being scraped at once, across all the requests.",
+	})
+)
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "propper_chrome_tabs_open",
+		Help: "Chrome tabs open.",
+	}, func() float64 {
+		return float64(browsers.OpenTabs())
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "propper_chrome_tabs_max",
+		Help: "Maximum number of Chrome tabs open at once.",
+	}, func() float64 {
+		return float64(config.MAX_TABS)
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "propper_semaphore_occupancy",
+		Help: "Fraction of the semaphore of the Chrome tabs in use, from 0 to 1.",
+	}, func() float64 {
+		if config.MAX_TABS <= 0 {
+			return 0
+		}
+		return float64(browsers.OpenTabs()) / float64(config.MAX_TABS)
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "propper_job_queue_depth",
+		Help: "Pages and downloads of the jobs queued waiting for a free Chrome tab.",
+	}, func() float64 {
+		return float64(browsers.WaitingTabs())
+	})
+}
+
+// Name of the type of err, like ConnectionError.
+func errorType(err error) string {
+	t := reflect.TypeOf(err)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
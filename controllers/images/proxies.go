@@ -0,0 +1,97 @@
+package images
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	config "propper/configs"
+	browserpool "propper/lib/browserpool"
+	logger "propper/lib/logger"
+	proxy "propper/lib/proxy"
+
+	. "propper/types/errors"
+)
+
+// Proxies of PROXIES, none until LoadProxies is called.
+var proxies, _ = proxy.NewPool(nil, 0, 0)
+
+// Loads the proxies of PROXIES. Must be called on startup, before any job
+// starts. The server must not start if it fails, as connecting directly when
+// proxies were asked for could expose its ip.
+func LoadProxies() error {
+	pool, err := proxy.NewPool(config.PROXIES, config.PROXY_MAX_FAILURES, time.Duration(config.PROXY_BENCH_TIME)*time.Second)
+	if err != nil {
+		return err
+	}
+	proxies = pool
+	return nil
+}
+
+// Transport for the http clients, rotating through the proxies in round robin.
+func proxiedTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		p := proxies.Next()
+		if p == nil {
+			return nil, nil
+		}
+		return p.URL, nil
+	}
+	return transport
+}
+
+// Opens a tab that connects through the proxy chosen by the job's rotation.
+// The proxy is nil when there are no proxies configured. The context of the
+// tab logs the ids stored in ctx, and its spans are children of the one in ctx.
+func acquireJobTab(ctx context.Context, j *job) (tab *browserpool.Tab, p *proxy.Proxy, err error) {
+	// includes the wait for a free tab, and launching the browser if needed
+	_, span := tracer.Start(ctx, "acquire tab")
+	defer func() { endSpan(span, err) }()
+
+	p = j.proxies.Pick()
+	span.SetAttributes(attribute.String("proxy", p.String()))
+	if p == nil {
+		tab, err = acquireTab(ctx)
+	} else {
+		tab, err = browsers.AcquireTabWithProxy(ctx, p.String(), config.PROXY_BYPASS_LIST)
+		if err != nil {
+			err = &InternalServerError{Err: "Couldn't open a browser tab", RawError: err}
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	tab.Ctx = trace.ContextWithSpan(logger.WithFieldsOf(tab.Ctx, ctx), trace.SpanFromContext(ctx))
+	return tab, p, nil
+}
+
+// Navigates the tab to url, reporting the result to the proxy of the tab.
+// Only the navigations of the tab are reported, the robots.txt fetches go
+// through the proxies of proxiedTransport instead.
+func navigateThroughProxy(ctx context.Context, j *job, p *proxy.Proxy, url string) error {
+	err := chromedp.Navigate(url).Do(ctx)
+	// a stopped job isn't a failure of the proxy
+	if ctx.Err() == nil {
+		reportProxyResult(ctx, j, p, err)
+	}
+	return err
+}
+
+// Counts navigation errors as failures of the proxy, benching it if it keeps failing.
+func reportProxyResult(ctx context.Context, j *job, p *proxy.Proxy, err error) {
+	if p == nil {
+		return
+	}
+	if err != nil {
+		logger.Warn(ctx, "Connection error through proxy", "proxy", p.String(), "error", err)
+		j.proxies.ReportFailure(p)
+		return
+	}
+	j.proxies.ReportSuccess(p)
+}
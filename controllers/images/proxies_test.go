@@ -0,0 +1,141 @@
+package images
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	config "propper/configs"
+	utils "propper/test/utils"
+)
+
+// Forward proxy stand-in that counts the requests going through it.
+type countingProxy struct {
+	mu       sync.Mutex
+	requests int
+}
+
+func (p *countingProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	p.requests += 1
+	p.mu.Unlock()
+	r.RequestURI = ""
+	res, err := http.DefaultTransport.RoundTrip(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+	for key, values := range res.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(res.StatusCode)
+	io.Copy(w, res.Body)
+}
+
+func (p *countingProxy) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.requests
+}
+
+func TestImagesAreDownloadedThroughProxy(t *testing.T) {
+	site := http.NewServeMux()
+	ts := httptest.NewServer(site)
+	defer ts.Close()
+	site.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<body><img src="%s/image/1"><img src="%s/image/2"></body>`, ts.URL, ts.URL)
+	})
+	site.HandleFunc("/image/", func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := ioutil.ReadFile("../../test/data/test_image.jpg")
+		w.Write(buf)
+	})
+	stand := &countingProxy{}
+	ps := httptest.NewServer(stand)
+	defer ps.Close()
+
+	siteUrl, selector, minCards, sleepTime := config.SITE_URL, config.CARD_IMG_SELECTOR, config.MIN_CARDS_PER_PAGE, config.SLEEP_TIME
+	downloadsDir, jobsDir, bypassList, proxyUrls := config.DOWNLOADS_SAVE_DIR, config.JOBS_DIR, config.PROXY_BYPASS_LIST, config.PROXIES
+	defer func() {
+		config.SITE_URL, config.CARD_IMG_SELECTOR, config.MIN_CARDS_PER_PAGE, config.SLEEP_TIME = siteUrl, selector, minCards, sleepTime
+		config.DOWNLOADS_SAVE_DIR, config.JOBS_DIR, config.PROXY_BYPASS_LIST, config.PROXIES = downloadsDir, jobsDir, bypassList, proxyUrls
+		LoadProxies()
+	}()
+	saveDir, _ := ioutil.TempDir("", "downloads")
+	defer os.RemoveAll(saveDir)
+	config.SITE_URL = ts.URL
+	config.CARD_IMG_SELECTOR = "img"
+	config.MIN_CARDS_PER_PAGE = 2
+	config.SLEEP_TIME = 0
+	config.DOWNLOADS_SAVE_DIR = saveDir
+	config.JOBS_DIR = saveDir
+	// chrome doesn't use proxies for localhost unless told so
+	config.PROXY_BYPASS_LIST = "<-loopback>"
+	config.PROXIES = []string{ps.URL}
+	if err := LoadProxies(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetImages(context.Background(), 2, 1); err != nil {
+		t.Fatal("Error getting images: ", err)
+	}
+	if requests := stand.count(); requests < 3 {
+		t.Error("Expected the page and images to go through the proxy, requests: ", requests)
+	}
+	dirs, _ := os.ReadDir(saveDir)
+	if !utils.Assert(t, 1, len(dirs), "Invalid number of downloads") {
+		return
+	}
+	manifest, err := readManifest(saveDir + "/" + dirs[0].Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range manifest.Images {
+		utils.Assert(t, ps.URL, record.Proxy, "Proxy not recorded for image "+record.Url)
+	}
+}
+
+func TestLoadProxiesRejectsInvalidProxies(t *testing.T) {
+	proxyUrls := config.PROXIES
+	defer func() { config.PROXIES = proxyUrls }()
+	config.PROXIES = []string{"ftp://proxy.example.com"}
+	if err := LoadProxies(); err == nil {
+		t.Error("Expected an error for an invalid proxy")
+	}
+	utils.Assert(t, 0, proxies.Len(), "The previous proxies should be kept")
+}
+
+func TestOnlyNavigationsAreReportedToTheProxy(t *testing.T) {
+	proxyUrls, maxFailures, robotsTxt := config.PROXIES, config.PROXY_MAX_FAILURES, config.RESPECT_ROBOTS_TXT
+	defer func() {
+		config.PROXIES, config.PROXY_MAX_FAILURES, config.RESPECT_ROBOTS_TXT = proxyUrls, maxFailures, robotsTxt
+		LoadProxies()
+	}()
+	config.PROXIES = []string{"http://127.0.0.1:1"}
+	config.PROXY_MAX_FAILURES = 1
+	config.RESPECT_ROBOTS_TXT = true
+	if err := LoadProxies(); err != nil {
+		t.Fatal(err)
+	}
+	j := &job{proxies: proxies.NewRotation(config.PROXY_ROTATION)}
+	p := j.proxies.Pick()
+
+	// robots.txt is fetched through the unreachable proxy, but not by the tab
+	if err := checkRobots(context.Background(), "http://127.0.0.1:1/page"); err == nil {
+		t.Fatal("Expected an error fetching robots.txt")
+	}
+	utils.Assert(t, true, proxies.IsAvailable(p), "Robots.txt errors shouldn't be reported to the proxy of the tab")
+
+	reportProxyResult(context.Background(), j, p, errors.New("net::ERR_PROXY_CONNECTION_FAILED"))
+	utils.Assert(t, false, proxies.IsAvailable(p), "Navigation errors should be reported to the proxy")
+}
@@ -0,0 +1,58 @@
+package images
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	config "propper/configs"
+	logger "propper/lib/logger"
+	ratelimit "propper/lib/ratelimit"
+
+	. "propper/types/errors"
+)
+
+// Limits the requests made to each host, shared by every job.
+var hostLimiter = ratelimit.NewHostLimiter(
+	ratelimit.Limits{
+		RequestsPerSecond: config.RATE_LIMIT_RPS,
+		Burst:             config.RATE_LIMIT_BURST,
+		MinDelay:          time.Duration(config.RATE_LIMIT_MIN_DELAY) * time.Millisecond,
+	},
+	parseHostLimits(config.RATE_LIMITS_PER_HOST),
+)
+
+// Parses limits with the format "<requests per second>:<burst>:<min delay in ms>".
+// Invalid values are ignored, so the host uses the default limits.
+func parseHostLimits(perHost map[string]string) map[string]ratelimit.Limits {
+	res := map[string]ratelimit.Limits{}
+	for host, value := range perHost {
+		parts := strings.Split(value, ":")
+		if len(parts) != 3 {
+			logger.Warn(context.Background(), "Invalid rate limit of host, using the default limits", "host", host, "value", value)
+			continue
+		}
+		rps, errRps := strconv.ParseFloat(parts[0], 64)
+		burst, errBurst := strconv.Atoi(parts[1])
+		minDelay, errMinDelay := strconv.Atoi(parts[2])
+		if errRps != nil || errBurst != nil || errMinDelay != nil {
+			logger.Warn(context.Background(), "Invalid rate limit of host, using the default limits", "host", host, "value", value)
+			continue
+		}
+		res[host] = ratelimit.Limits{
+			RequestsPerSecond: rps,
+			Burst:             burst,
+			MinDelay:          time.Duration(minDelay) * time.Millisecond,
+		}
+	}
+	return res
+}
+
+func waitForHost(ctx context.Context, url string) error {
+	if err := hostLimiter.Wait(ctx, url); err != nil {
+		return &InternalServerError{Err: fmt.Sprintf("Stopped while waiting for the rate limit of url (%s)", url), RawError: err}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package images
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	config "propper/configs"
+	logger "propper/lib/logger"
+	robots "propper/lib/robots"
+
+	. "propper/types/errors"
+)
+
+var robotsChecker = robots.NewChecker(
+	config.ROBOTS_USER_AGENT,
+	time.Duration(config.ROBOTS_CACHE_TTL)*time.Second,
+	&http.Client{Timeout: 10 * time.Second, Transport: proxiedTransport()},
+)
+
+// Robots rules of the url's host, or nil if they don't have to be checked.
+func robotsRulesOf(ctx context.Context, rawUrl string) (*robots.Rules, *url.URL, error) {
+	if !config.RESPECT_ROBOTS_TXT {
+		return nil, nil, nil
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		// invalid urls fail later, when navigating to them
+		return nil, nil, nil
+	}
+	rules, err := robotsChecker.Rules(ctx, u)
+	if err != nil {
+		return nil, nil, &ConnectionError{Err: fmt.Sprintf("Error getting robots.txt of url (%s)", rawUrl), RawError: err}
+	}
+	return rules, u, nil
+}
+
+func checkRobots(ctx context.Context, rawUrl string) error {
+	rules, u, err := robotsRulesOf(ctx, rawUrl)
+	if err != nil {
+		return err
+	}
+	if rules == nil || rules.AllowedURL(u) {
+		return nil
+	}
+	return &RobotsDisallowedError{Err: fmt.Sprintf("url (%s) can't be crawled", rawUrl)}
+}
+
+func crawlDelayOf(ctx context.Context, rawUrl string) (time.Duration, error) {
+	rules, _, err := robotsRulesOf(ctx, rawUrl)
+	if err != nil || rules == nil {
+		return 0, err
+	}
+	if rules.CrawlDelay > 0 {
+		logger.Debug(ctx, "Using crawl delay from robots.txt", "crawl_delay", rules.CrawlDelay)
+	}
+	return rules.CrawlDelay, nil
+}
+
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -2,23 +2,34 @@ package images
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"math"
+	"net/http"
+	"net/url"
 	"os"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/chromedp/cdproto/cdp"
 	"github.com/chromedp/cdproto/dom"
 	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/chromedp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	config "propper/configs"
+	circuitbreaker "propper/lib/circuitbreaker"
+	concurrency "propper/lib/concurrency"
+	imagehash "propper/lib/imagehash"
 	logger "propper/lib/logger"
-	sem "propper/lib/semaphore"
+	proxy "propper/lib/proxy"
 
 	. "propper/types/errors"
 )
@@ -31,6 +42,10 @@ func urlOfPage(url string, page int) string {
 }
 
 func extractSrcFromNode(node *cdp.Node) string {
+	candidate, ok := selectCandidate(srcsetCandidatesOfNode(node), config.IMAGE_RESOLUTION_PREFERENCE, config.IMAGE_TARGET_WIDTH)
+	if ok {
+		return candidate.Url
+	}
 	src, exists := node.Attribute("data-src")
 	if exists {
 		return src
@@ -43,7 +58,35 @@ func extractSrcFromNode(node *cdp.Node) string {
 	return ""
 }
 
-func downloadImages(ctx context.Context, urls []string, path string) error {
+// State shared by the stages of one call to GetImages.
+type job struct {
+	// images loaded by the pages, nil if they aren't captured
+	captured *capturedImages
+	proxies  *proxy.Rotation
+	// settings of the scraped site, nil if it isn't configured
+	site *site
+	// concurrency of the pages, set once the urls are collected
+	concurrency *concurrency.AdaptiveLimiter
+	// checkpoints of the job, nil if it isn't saved
+	running *runningJob
+	// title and tags of the images found on the pages, by url
+	memes sync.Map
+	// normalized url of the collected images, by url, to find the captured ones
+	imageKeys map[string]string
+	// the scraping stops at the first meme seen until it, nil to scrape amount memes
+	since *time.Time
+}
+
+// Saves the images in path. The ones already captured while loading the pages
+// are written directly, the rest are fetched navigating to their url in the
+// tab of ctx, which connects through tabProxy.
+func downloadImages(ctx context.Context, j *job, urls []string, path string, tabProxy *proxy.Proxy) (res []ImageRecord, err error) {
+	ctx, span := tracer.Start(ctx, "downloadImages", trace.WithAttributes(attribute.Int("images", len(urls))))
+	var totalBytes int
+	defer func() {
+		span.SetAttributes(attribute.Int("bytes", totalBytes))
+		endSpan(span, err)
+	}()
 	var requestInProgressWG sync.WaitGroup
 	var currReqId network.RequestID
 
@@ -57,43 +100,104 @@ func downloadImages(ctx context.Context, urls []string, path string) error {
 			}
 		}
 	})
+	records := []ImageRecord{}
+	// files are numbered after the ones saved before resuming the job, as
+	// the order of the urls can change between both runs
+	saved := j.running.imagesCount()
 	var waitForActions sync.WaitGroup
 	waitForActions.Add(1)
-	err := chromedp.Run(ctx,
+	err = chromedp.Run(ctx,
 		chromedp.ActionFunc(func(ctx context.Context) error {
 			defer waitForActions.Done()
 			for i, url := range urls {
-				requestInProgressWG.Add(1)
-				err := chromedp.Navigate(url).Do(ctx)
-				if err != nil {
-					return &ConnectionError{Err: fmt.Sprintf("Error downloading image from url: %s", url), RawError: err}
+				if record, ok := j.running.image(url); ok {
+					records = append(records, record)
+					continue
 				}
-				requestInProgressWG.Wait()
-				buf, err := network.GetResponseBody(currReqId).Do(ctx)
-				if err != nil {
-					return &InternalServerError{Err: "Unexpected error downloading image.", RawError: err}
+				_, span := tracer.Start(ctx, "download image", trace.WithAttributes(attribute.Int("index", i+1), attribute.String("url", url)))
+				if err := checkRobots(ctx, url); err != nil {
+					endSpan(span, err)
+					return err
+				}
+				image, ok := j.captured.load(j.keyOf(url))
+				buf, usedProxy := image.body, image.proxy
+				span.SetAttributes(attribute.Bool("captured", ok))
+				if !ok {
+					usedProxy = tabProxy.String()
+					if err := waitForHost(ctx, url); err != nil {
+						endSpan(span, err)
+						return err
+					}
+					requestInProgressWG.Add(1)
+					err := navigateThroughProxy(ctx, j, tabProxy, url)
+					if err != nil {
+						err = &ConnectionError{Err: fmt.Sprintf("Error downloading image from url: %s", url), RawError: err}
+						endSpan(span, err)
+						return err
+					}
+					requestInProgressWG.Wait()
+					buf, err = network.GetResponseBody(currReqId).Do(ctx)
+					if err != nil {
+						err = &InternalServerError{Err: "Unexpected error downloading image.", RawError: err}
+						endSpan(span, err)
+						return err
+					}
 				}
-				if err := ioutil.WriteFile(fmt.Sprintf("%s/%d.jpg", path, i+1), buf, 0644); err != nil {
-					return &InternalServerError{Err: "Unexpected error writing image locally.", RawError: err}
+				span.SetAttributes(attribute.Int("bytes", len(buf)))
+				saved += 1
+				fileName := fmt.Sprintf("%d.jpg", saved)
+				if err := ioutil.WriteFile(fmt.Sprintf("%s/%s", path, fileName), buf, 0644); err != nil {
+					err = &InternalServerError{Err: "Unexpected error writing image locally.", RawError: err}
+					endSpan(span, err)
+					return err
+				}
+				imagesDownloaded.Inc()
+				bytesWritten.Add(float64(len(buf)))
+				totalBytes += len(buf)
+				hashes, err := imagehash.FromBytes(buf)
+				if err != nil {
+					logger.Warn(ctx, "Couldn't compute the hashes of the image", "url", url, "error", err)
 				}
+				sum := sha256.Sum256(buf)
+				record := ImageRecord{Url: url, File: fileName, Hashes: hashes, Sha256: hex.EncodeToString(sum[:]), Proxy: usedProxy}
+				records = append(records, record)
+				j.running.imageDone(ctx, record)
+				span.End()
 			}
 			return nil
 		}),
 	)
 
 	waitForActions.Wait()
-	logger.Log("Finished downloading the images")
-	return err
+	logger.Info(ctx, "Finished downloading the images", "images", len(records))
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Normalized url of an image collected by the job, used to find it among the captured ones.
+func (j *job) keyOf(url string) string {
+	if key, ok := j.imageKeys[url]; ok {
+		return key
+	}
+	return url
 }
 
-func getImagesURLS(ctx context.Context, amount, threads int) ([]string, error) {
-	logger.Log("Start getting the urls")
+// Collects the urls of the first amount images of the site. If the job
+// captures images, the ones loaded by the pages are stored in it. If the job
+// has a since time, the pages stop at the first meme seen until then, and
+// only the newer ones are returned, up to amount.
+func getImagesURLS(ctx context.Context, j *job, amount, threads int) (res []string, err error) {
+	ctx, span := tracer.Start(ctx, "getImagesURLS", trace.WithAttributes(attribute.Int("amount", amount)))
+	defer func() { endSpan(span, err) }()
+	logger.Debug(ctx, "Start getting the urls")
 
 	if amount < 1 {
 		return nil, &InvalidParametersError{Err: "amount must be greater or equal than 1."}
 	}
-	if threads < 1 || threads > 5 {
-		return nil, &InvalidParametersError{Err: "threads must be greater or equal than 1, and lesser or equal than 5."}
+	if threads < 1 || threads > config.CONCURRENCY_MAX {
+		return nil, &InvalidParametersError{Err: fmt.Sprintf("threads must be greater or equal than 1, and lesser or equal than %d.", config.CONCURRENCY_MAX)}
 	}
 
 	var maxConcurrentThreads int = threads
@@ -101,137 +205,534 @@ func getImagesURLS(ctx context.Context, amount, threads int) ([]string, error) {
 	if maxConcurrentThreads > maxTotalQueries {
 		maxConcurrentThreads = maxTotalQueries
 	}
-	logger.Log(fmt.Sprintf("max concurrent threads: %d", maxConcurrentThreads))
-	logger.Log(fmt.Sprintf("max total queries: %d", maxTotalQueries))
-	semConcurrentThreads := sem.NewCustomSemaphore(maxConcurrentThreads)
-	defer semConcurrentThreads.Close()
+	logger.Debug(ctx, "Scheduling pages", "max_concurrent_threads", maxConcurrentThreads, "max_total_queries", maxTotalQueries)
+	// threads is only the starting point, it changes with how the site responds
+	limiter := concurrency.NewAdaptiveLimiter(
+		config.CONCURRENCY_MIN,
+		config.CONCURRENCY_MAX,
+		maxConcurrentThreads,
+		config.CONCURRENCY_BACKOFF,
+		config.CONCURRENCY_LATENCY_TOLERANCE,
+	)
+	j.concurrency = limiter
 
 	resMap := sync.Map{}
 	var imageUrls []string
+	j.imageKeys = map[string]string{}
 
-	errs := make(chan error, maxConcurrentThreads)
+	// only the first error is kept
+	errs := make(chan error, 1)
+	reportError := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
 
 	var wg sync.WaitGroup
-	var tabs []context.Context
-	for i := 0; i < maxConcurrentThreads; i += 1 {
-		newCtx, _ := chromedp.NewContext(ctx)
-		tabs = append(tabs, newCtx)
-	}
-	resolvedUrls := 0
-	getNodesOfPage := func(cc context.Context, page int) {
-		if err := chromedp.Run(cc,
-			chromedp.ActionFunc(func(cc context.Context) error {
-				defer wg.Done()
-				defer semConcurrentThreads.Signal()
+	blocked := newBlockedRequests()
+	if config.BLOCK_RESOURCES {
+		defer blocked.log(ctx)
+	}
+	// updated by the page goroutines while the scheduler reads it
+	var resolvedUrls int64
+	// pages the site refused to serve for too many requests, queried again in
+	// the next round once their delay is over, up to THROTTLE_MAX_RETRIES times
+	var throttledMu sync.Mutex
+	throttled := []int{}
+	throttleRetries := map[int]int{}
+	retryAt := map[int]time.Time{}
+	// index of the first url seen before j.since, by page
+	var seenMu sync.Mutex
+	seenFrom := map[int]int{}
+	// first page with a meme seen before j.since, 0 until it is found
+	var lastPage int64
+	checkSeen := func(page int, urls []string) error {
+		if j.since == nil {
+			return nil
+		}
+		i, err := firstSeenBefore(*j.since, urls)
+		if err != nil || i < 0 {
+			return err
+		}
+		seenMu.Lock()
+		seenFrom[page] = i
+		if lastPage == 0 || int64(page) < lastPage {
+			atomic.StoreInt64(&lastPage, int64(page))
+		}
+		seenMu.Unlock()
+		logger.Debug(ctx, "Found a meme seen before", "page", page, "url", urls[i])
+		return nil
+	}
+	getNodesOfPage := func(page int) {
+		defer wg.Done()
+		defer limiter.Release()
+		pagesInFlight.Add(1)
+		defer pagesInFlight.Add(-1)
+		pageUrl := urlOfPage(config.SITE_URL, page)
+		pageCtx, span := tracer.Start(ctx, "page", trace.WithAttributes(attribute.Int("page", page), attribute.String("url", pageUrl)))
+		defer span.End()
+		reportError := func(err error) {
+			endSpan(span, err)
+			reportError(err)
+		}
+
+		// throttled pages wait for their delay keeping their thread, so the
+		// site gets fewer pages at once meanwhile
+		throttledMu.Lock()
+		wait := time.Until(retryAt[page])
+		throttledMu.Unlock()
+		if wait > 0 {
+			if err := sleepWithContext(pageCtx, wait); err != nil {
+				reportError(&InternalServerError{Err: "Stopped while waiting to retry a throttled page", RawError: err})
+				return
+			}
+		}
+
+		// every page uses a new tab of the shared browsers
+		tab, tabProxy, err := acquireJobTab(pageCtx, j)
+		if err != nil {
+			reportError(err)
+			return
+		}
+		defer tab.Release()
+		var rules *blockingRules
+		if config.BLOCK_RESOURCES {
+			rules = newBlockingRules(config.BLOCK_IMAGES_ON_DISCOVERY)
+		}
+		var credentials *url.Userinfo
+		if tabProxy != nil {
+			credentials = tabProxy.URL.User
+		}
+		if rules != nil || credentials != nil || j.site.hasHeaders() {
+			err := chromedp.Run(tab.Ctx, enableInterception(tab.Ctx, rules, credentials, j.site, blocked))
+			if err != nil {
+				reportError(&InternalServerError{Err: "Unexpected error enabling request interception", RawError: err})
+				return
+			}
+		}
+		if j.captured != nil {
+			captureImageResponses(tab.Ctx, j.captured, tabProxy.String())
+		}
+		if err := chromedp.Run(tab.Ctx, applySite(j.site)); err != nil {
+			reportError(&InternalServerError{Err: "Unexpected error applying the site settings", RawError: err})
+			return
+		}
+		var documentStatus int64
+		var documentHeaders atomic.Value
+		chromedp.ListenTarget(tab.Ctx, func(v interface{}) {
+			if ev, ok := v.(*network.EventResponseReceived); ok && ev.Type == network.ResourceTypeDocument {
+				// the page is the first document, the rest come from its frames
+				if atomic.CompareAndSwapInt64(&documentStatus, 0, ev.Response.Status) {
+					documentHeaders.Store(ev.Response.Headers)
+				}
+			}
+		})
 
-				logger.Log(fmt.Sprintf("Go routine for page %d started", page))
+		err = chromedp.Run(tab.Ctx,
+			chromedp.ActionFunc(func(cc context.Context) error {
+				logger.Debug(cc, "Go routine for page started", "page", page)
 				var localNodes []*cdp.Node
-				url := urlOfPage(config.SITE_URL, page)
 				localUrls := []string{}
+				localMemes := map[string]MemeInfo{}
 
-				err := chromedp.Navigate(url).Do(cc)
+				if err := checkRobots(cc, pageUrl); err != nil {
+					return err
+				}
+				if err := waitForHost(cc, pageUrl); err != nil {
+					return err
+				}
+				start := time.Now()
+				_, navigateSpan := tracer.Start(cc, "navigate")
+				err := navigateThroughProxy(cc, j, tabProxy, pageUrl)
 				if err != nil {
-					return &ConnectionError{Err: fmt.Sprintf("Error connecting to URL (%s)", url), RawError: err}
+					limiter.ReportFailure()
+					err = &ConnectionError{Err: fmt.Sprintf("Error connecting to URL (%s)", pageUrl), RawError: err}
+					endSpan(navigateSpan, err)
+					return err
 				}
+				status := atomic.LoadInt64(&documentStatus)
+				navigateSpan.SetAttributes(attribute.Int64("status", status))
+				navigateSpan.End()
+				if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+					limiter.ReportFailure()
+					headers, _ := documentHeaders.Load().(network.Headers)
+					throttledMu.Lock()
+					defer throttledMu.Unlock()
+					throttleRetries[page] += 1
+					retries := throttleRetries[page]
+					delay := throttleDelay(retries, retryAfterOf(headers, time.Now()))
+					if retries > config.THROTTLE_MAX_RETRIES {
+						return &SiteUnavailableError{Err: fmt.Sprintf("The site kept throttling the page (%s)", pageUrl), RetryAfter: delay}
+					}
+					logger.Warn(cc, "Page throttled", "page", page, "status", status, "retry", retries, "delay", delay)
+					retryAt[page] = time.Now().Add(delay)
+					throttled = append(throttled, page)
+					return nil
+				}
+				limiter.ReportSuccess(time.Since(start))
 				// wait to load resources
+				_, sleepSpan := tracer.Start(cc, "sleep")
 				err = chromedp.Sleep(time.Second * time.Duration(config.SLEEP_TIME)).Do(cc)
+				endSpan(sleepSpan, err)
 				if err != nil {
 					return &InternalServerError{Err: err.Error(), RawError: err}
 				}
+				_, searchSpan := tracer.Start(cc, "dom search", trace.WithAttributes(attribute.String("selector", config.CARD_IMG_SELECTOR)))
 				_, resultCount, err := dom.PerformSearch(config.CARD_IMG_SELECTOR).Do(cc)
 				if err != nil {
+					endSpan(searchSpan, err)
 					return &InternalServerError{Err: err.Error(), RawError: err}
 				}
 				if resultCount == 0 {
-					return &NotFoundError{Err: fmt.Sprintf("Couldn't find any images on url(%s)", url)}
+					err = &NotFoundError{Err: fmt.Sprintf("Couldn't find any images on url(%s)", pageUrl)}
+					endSpan(searchSpan, err)
+					return err
 				}
 				err = chromedp.Nodes(config.CARD_IMG_SELECTOR, &localNodes, chromedp.BySearch).Do(cc)
+				searchSpan.SetAttributes(attribute.Int("nodes", len(localNodes)))
+				endSpan(searchSpan, err)
 				if err != nil {
 					return &InternalServerError{Err: "Unexpected error selecting nodes", RawError: err}
 				}
 
 				for _, node := range localNodes {
-					localUrls = append(localUrls, extractSrcFromNode(node))
+					src := extractSrcFromNode(node)
+					if u, ok := resolveImageURL(pageUrl, src); ok {
+						src = u.String()
+					}
+					// invalid values are kept, so the download reports which src is invalid
+					localUrls = append(localUrls, src)
+					localMemes[src] = memeOfNode(node)
+					j.memes.Store(src, localMemes[src])
+				}
+				collectCookies(cc, j.site, pageUrl)
+				if err := checkSeen(page, localUrls); err != nil {
+					return err
 				}
 				resMap.Store(page, localUrls)
-				resolvedUrls += len(localNodes)
-				logger.Log(fmt.Sprintf("Go routine for page %d finished", page))
+				j.running.pageDone(cc, page, localUrls, localMemes)
+				pagesScraped.Inc()
+				atomic.AddInt64(&resolvedUrls, int64(len(localNodes)))
+				logger.Debug(cc, "Go routine for page finished", "page", page, "urls", len(localUrls))
 				return nil
 			}),
-		); err != nil {
-			errs <- err
-			return
+		)
+		if err != nil {
+			reportError(err)
 		}
 	}
 
-	logger.Log("Start routines")
-	for i := 0; i < maxTotalQueries; i += 1 {
-		if resolvedUrls+semConcurrentThreads.CurrentlyRunning()*config.MIN_CARDS_PER_PAGE > amount {
-			logger.Log("Preemptive break on starting new routines")
-			break
-		}
-		wg.Add(1)
-		semConcurrentThreads.Take()
-		go getNodesOfPage(tabs[i%maxConcurrentThreads], i+1)
+	crawlDelay, err := crawlDelayOf(ctx, config.SITE_URL)
+	if err != nil {
+		return nil, err
 	}
-	wg.Wait()
-	close(errs)
-	if len(errs) > 0 {
-		return nil, <-errs
+
+	// Pages are queried in rounds. If after removing the duplicated urls there
+	// aren't enough images, a new round is started with the throttled pages
+	// and the following ones.
+	nextPage := 1
+	pagesToQuery := maxTotalQueries
+	launched := 0
+	// pages scraped before resuming the job aren't queried again
+	for page, urls := range j.running.pages() {
+		if err := checkSeen(page, urls); err != nil {
+			return nil, err
+		}
+		resMap.Store(page, urls)
+		resolvedUrls += int64(len(urls))
 	}
+	for {
+		logger.Debug(ctx, "Start routines")
+		throttledMu.Lock()
+		retries := throttled
+		throttled = []int{}
+		throttledMu.Unlock()
+		for i := 0; i < pagesToQuery || len(retries) > 0; i += 1 {
+			// pages scraped before resuming the job don't use up the queries
+			for len(retries) == 0 && j.running.hasPage(nextPage) {
+				nextPage += 1
+			}
+			// the memes after a seen one aren't new
+			if last := int(atomic.LoadInt64(&lastPage)); last > 0 {
+				if len(retries) > 0 && retries[0] > last {
+					retries = retries[1:]
+					continue
+				}
+				if len(retries) == 0 && nextPage > last {
+					logger.Debug(ctx, "Break on reaching the memes seen before")
+					break
+				}
+			}
+			if int(atomic.LoadInt64(&resolvedUrls))+limiter.InFlight()*config.MIN_CARDS_PER_PAGE > amount {
+				logger.Debug(ctx, "Preemptive break on starting new routines")
+				break
+			}
+			if launched > 0 && crawlDelay > 0 {
+				if err := sleepWithContext(ctx, crawlDelay); err != nil {
+					reportError(&InternalServerError{Err: "Stopped while waiting for the crawl delay", RawError: err})
+					break
+				}
+			}
+			if err := limiter.Acquire(ctx); err != nil {
+				reportError(&InternalServerError{Err: "Stopped while waiting for a free thread", RawError: err})
+				break
+			}
+			page := nextPage
+			if len(retries) > 0 {
+				page, retries = retries[0], retries[1:]
+			} else {
+				nextPage += 1
+			}
+			wg.Add(1)
+			launched += 1
+			go getNodesOfPage(page)
+		}
+		// retries left after a break go to the next round
+		throttledMu.Lock()
+		throttled = append(throttled, retries...)
+		throttledMu.Unlock()
+		wg.Wait()
+		if len(errs) > 0 {
+			return nil, <-errs
+		}
 
-	keys := []int{}
-	resMap.Range(func(key interface{}, value interface{}) bool {
-		keys = append(keys, key.(int))
-		return true
-	})
-	sort.Ints(keys)
-	for _, page := range keys {
-		urls, ok := resMap.Load(page)
-		if !ok {
-			return nil, &InternalServerError{Err: "No results retrieved for one of the pages"}
+		keys := []int{}
+		resMap.Range(func(key interface{}, value interface{}) bool {
+			keys = append(keys, key.(int))
+			return true
+		})
+		sort.Ints(keys)
+		pagesUrls, pagesKeys := []string{}, []string{}
+		seenReached := false
+		for _, page := range keys {
+			urls, ok := resMap.Load(page)
+			if !ok {
+				return nil, &InternalServerError{Err: "No results retrieved for one of the pages"}
+			}
+			seenMu.Lock()
+			i, seen := seenFrom[page]
+			seenMu.Unlock()
+			pageSrcs := urls.([]string)
+			if seen {
+				pageSrcs = pageSrcs[:i]
+			}
+			pageUrl := urlOfPage(config.SITE_URL, page)
+			for _, src := range pageSrcs {
+				key := imageKey(pageUrl, src)
+				if _, ok := j.imageKeys[src]; !ok {
+					j.imageKeys[src] = key
+				}
+				pagesUrls = append(pagesUrls, src)
+				pagesKeys = append(pagesKeys, key)
+			}
+			if seen {
+				seenReached = true
+				break
+			}
+		}
+		previousCount := len(imageUrls)
+		imageUrls = uniqueURLs(pagesUrls, pagesKeys)
+		if len(imageUrls) >= amount {
+			break
+		}
+		throttledMu.Lock()
+		pendingRetries := len(throttled)
+		throttledMu.Unlock()
+		// throttled pages before the seen meme are still needed
+		if seenReached && pendingRetries == 0 {
+			break
+		}
+		if len(imageUrls) == previousCount && pendingRetries == 0 {
+			return nil, &BadRequestError{Err: "Not enough images to meet the amount"}
 		}
-		imageUrls = append(imageUrls, urls.([]string)...)
+
+		missing := amount - len(imageUrls)
+		logger.Info(ctx, "Querying more pages", "duplicated_urls", len(pagesUrls)-len(imageUrls), "missing", missing)
+		pagesToQuery = int(math.Ceil(float64(missing) / float64(config.MIN_CARDS_PER_PAGE)))
+		atomic.StoreInt64(&resolvedUrls, int64(len(imageUrls)))
+	}
+	if j.captured != nil {
+		j.captured.wait()
+		logger.Debug(ctx, "Images captured while loading the pages", "images", j.captured.count())
 	}
-	if amount > len(imageUrls) {
-		return nil, &BadRequestError{Err: "Not enough images to meet the amount"}
+	stats := limiter.Stats()
+	if len(imageUrls) > amount {
+		imageUrls = imageUrls[0:amount]
 	}
-	logger.Log("Finished getting the urls")
-	return imageUrls[0:amount], nil
+	logger.Info(ctx, "Finished getting the urls", "urls", len(imageUrls), "initial_concurrency", stats.Initial, "final_concurrency", stats.Final, "peak_concurrency", stats.Peak)
+	return imageUrls, nil
 }
 
 // Given a number of images and number of threads to use. It takes care of coordinating
 // the search and download of the images of the specified site in configs.
-// It returns the urls of the downloaded images.
-func GetImages(amount, threads int) ([]string, error) {
-	// create context
-	maintCtx, _ := chromedp.NewContext(
-		context.Background(),
-		chromedp.WithLogf(log.Printf),
-	)
-	imagesCtx, _ := chromedp.NewContext(
-		maintCtx,
-		chromedp.WithLogf(log.Printf),
-	)
+// It returns the urls of the downloaded images. The job stops when ctx is done.
+func GetImages(ctx context.Context, amount, threads int) ([]string, error) {
+	return runJob(ctx, JobState{
+		ID:        newJobID(),
+		Site:      config.SITE_URL,
+		Amount:    amount,
+		Threads:   threads,
+		StartedAt: time.Now().UTC(),
+	})
+}
+
+// Like GetImages, but only the memes first seen after since are returned, up
+// to amount. See resolveSince for the values of since.
+func GetNewImages(ctx context.Context, since string, amount, threads int) ([]string, error) {
+	sinceTime, err := resolveSince(since)
+	if err != nil {
+		return nil, err
+	}
+	return runJob(ctx, JobState{
+		ID:        newJobID(),
+		Site:      config.SITE_URL,
+		Amount:    amount,
+		Threads:   threads,
+		StartedAt: time.Now().UTC(),
+		Since:     &sinceTime,
+	})
+}
+
+// Runs a new job, or resumes one from its state.
+func runJob(ctx context.Context, state JobState) ([]string, error) {
 	// create a timeout as a safety net to prevent any infinite wait loops
-	maintCtx, cancel := context.WithTimeout(maintCtx, time.Duration(config.TIMEOUT)*time.Second)
+	jobCtx, cancel := context.WithTimeout(ctx, time.Duration(config.TIMEOUT)*time.Second)
 	defer cancel()
 
-	imageUrls, err := getImagesURLS(maintCtx, amount, threads)
+	amount, threads, resumed := state.Amount, state.Threads, state.Status == JobInterrupted
+	jobCtx = logger.WithFields(jobCtx, "job_id", state.ID)
+	jobCtx, running, err := startJob(jobCtx, state)
 	if err != nil {
 		return nil, err
 	}
+	jobCtx, span := tracer.Start(jobCtx, "GetImages", trace.WithAttributes(
+		attribute.String("job_id", state.ID),
+		attribute.Int("amount", amount),
+		attribute.Int("threads", threads),
+		attribute.Bool("resumed", resumed),
+	))
+	jobsRunning.Add(1)
+	defer jobsRunning.Add(-1)
+	logger.Info(jobCtx, "Job started", "amount", amount, "threads", threads, "resumed", resumed)
+	breaker := breakerOf(config.SITE_URL)
+	err = allowSite(breaker)
+	var urls []string
+	if err == nil {
+		urls, err = getImages(ctx, jobCtx, breaker, running)
+		err = contextError(jobCtx, err)
+	}
+	err = finishJob(jobCtx, running, err)
+	span.SetAttributes(attribute.Int("images", len(urls)))
+	endSpan(span, err)
+	if err != nil {
+		jobErrors.WithLabelValues(errorType(err)).Inc()
+		logger.Error(jobCtx, "Job failed", "error", err)
+		return nil, err
+	}
+	logger.Info(jobCtx, "Job finished", "images", len(urls))
+	return urls, nil
+}
 
-	folderName := time.Now().UTC().Format("2006_01_02 15:04:05")
-	saveDirectoryPath := fmt.Sprintf("%s/%s", config.DOWNLOADS_SAVE_DIR, folderName)
-	err = os.Mkdir(saveDirectoryPath, 0755)
+func newJobID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Once the context of a job is done its stages fail with connection or
+// internal errors, which are replaced by the reason the job was stopped.
+func contextError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &TimeoutError{Err: "The request didn't finish within its timeout", RawError: err}
+	}
+	return &InternalServerError{Err: "The request was canceled", RawError: ctx.Err()}
+}
+
+// Only the pages of the site are reported to its breaker, failures
+// downloading the images usually come from other hosts. ctx is the context of
+// the client, jobCtx the one limited by the server's timeout.
+func getImages(ctx context.Context, jobCtx context.Context, breaker *circuitbreaker.Breaker, running *runningJob) ([]string, error) {
+	amount, threads := running.state.Amount, running.state.Threads
+	j := &job{proxies: proxies.NewRotation(config.PROXY_ROTATION), site: siteOf(config.SITE_URL), running: running, since: running.state.Since}
+	// the memes of the pages scraped before resuming the job are indexed too
+	for url, info := range running.memes() {
+		j.memes.Store(url, info)
+	}
+	if config.CAPTURE_IMAGES_ON_DISCOVERY {
+		j.captured = newCapturedImages(config.CAPTURE_MAX_SIZE * 1024 * 1024)
+	}
+	imageUrls, err := getImagesURLS(jobCtx, j, amount, threads)
+	if j.concurrency != nil {
+		running.setConcurrency(j.concurrency.Stats())
+	}
+	reportSiteResult(ctx, jobCtx, breaker, err)
+	saveCookies(jobCtx, j.site)
 	if err != nil {
-		return nil, &InternalServerError{Err: err.Error(), RawError: err}
+		return nil, err
+	}
+	if len(imageUrls) == 0 {
+		logger.Info(jobCtx, "There are no new memes")
+		return []string{}, nil
 	}
 
-	err = downloadImages(imagesCtx, imageUrls, saveDirectoryPath)
+	// a resumed job keeps saving its images in the same directory
+	saveDirectoryPath := running.directory()
+	if len(saveDirectoryPath) == 0 {
+		folderName := time.Now().UTC().Format("2006_01_02 15:04:05")
+		saveDirectoryPath = fmt.Sprintf("%s/%s", config.DOWNLOADS_SAVE_DIR, folderName)
+		err = os.Mkdir(saveDirectoryPath, 0755)
+		if err != nil {
+			return nil, &InternalServerError{Err: err.Error(), RawError: err}
+		}
+		running.setDirectory(jobCtx, saveDirectoryPath)
+	}
+
+	tab, tabProxy, err := acquireJobTab(jobCtx, j)
 	if err != nil {
 		return nil, err
 	}
-	return imageUrls, nil
+	var credentials *url.Userinfo
+	if tabProxy != nil {
+		credentials = tabProxy.URL.User
+	}
+	if credentials != nil || j.site.hasHeaders() {
+		err = chromedp.Run(tab.Ctx, enableInterception(tab.Ctx, nil, credentials, j.site, nil))
+		if err != nil {
+			tab.Release()
+			return nil, &InternalServerError{Err: "Unexpected error enabling request interception", RawError: err}
+		}
+	}
+	if err := chromedp.Run(tab.Ctx, applySite(j.site)); err != nil {
+		tab.Release()
+		return nil, &InternalServerError{Err: "Unexpected error applying the site settings", RawError: err}
+	}
+	records, err := downloadImages(tab.Ctx, j, imageUrls, saveDirectoryPath, tabProxy)
+	tab.Release()
+	if err != nil {
+		return nil, err
+	}
+	if config.DROP_NEAR_DUPLICATES {
+		if dropped := dropNearDuplicates(jobCtx, saveDirectoryPath, records); dropped > 0 {
+			logger.Warn(jobCtx, "Near duplicates dropped, returning fewer images than asked", "dropped", dropped, "images", len(records)-dropped, "amount", amount)
+		}
+	}
+	running.setImages(records)
+	indexMemes(jobCtx, j, records)
+	stats := j.concurrency.Stats()
+	err = writeManifest(saveDirectoryPath, &Manifest{CreatedAt: time.Now().UTC(), Site: config.SITE_URL, Concurrency: &stats, Images: records})
+	if err != nil {
+		return nil, err
+	}
+
+	downloadedUrls := []string{}
+	for _, record := range records {
+		if len(record.DuplicateOf) == 0 {
+			downloadedUrls = append(downloadedUrls, record.Url)
+		}
+	}
+	return downloadedUrls, nil
 }
@@ -1,17 +1,26 @@
 package images_test
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"image"
+	"image/color"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	config "propper/configs"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	controller "propper/controllers/images"
+	catalogpkg "propper/lib/catalog"
+	imagehash "propper/lib/imagehash"
 	utils "propper/test/utils"
 
 	errors "propper/types/errors"
@@ -19,6 +28,7 @@ import (
 
 var testDirectory = "../../test"
 var downloadsDirectory = testDirectory + "/downloads"
+var jobsDirectory = testDirectory + "/jobs"
 
 func testHtml(imagesNumber int, url string) string {
 	res := `
@@ -33,6 +43,35 @@ func testHtml(imagesNumber int, url string) string {
 	return res
 }
 
+// Html with a different image url for each card, numbered from the given offset.
+func testHtmlWithUniqueImages(imagesNumber, offset int, url string) string {
+	res := `
+	<body>
+	<p id="content"">Original content.</p>`
+	for i := 0; i < imagesNumber; i += 1 {
+		res += fmt.Sprintf(`
+		<img src="%s/%d?utm_source=test">`, url, offset+i)
+	}
+	res += `</body>
+	`
+	return res
+}
+
+func pageNumber(r *http.Request) int {
+	page := 1
+	fmt.Sscanf(r.URL.Path, "/page/%d", &page)
+	return page
+}
+
+// Serves pages with unique images. Each page repeats the last `overlap`
+// images of the previous page, as when the site shifts content while paginating.
+func returnPagesHandler(imagesNumber, overlap int, url string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		offset := (pageNumber(r) - 1) * (imagesNumber - overlap)
+		returnHtmlHandler(testHtmlWithUniqueImages(imagesNumber, offset, url))(w, r)
+	}
+}
+
 func imageHandler(w http.ResponseWriter, r *http.Request) {
 	fileBytes, err := ioutil.ReadFile(testDirectory + "/data/test_image.jpg")
 	if err != nil {
@@ -63,45 +102,79 @@ func setupServerWithBlankBody() (*httptest.Server, *http.ServeMux) {
 	config.MIN_CARDS_PER_PAGE = 5
 	config.SITE_URL = ts.URL
 	config.DOWNLOADS_SAVE_DIR = downloadsDirectory
+	config.JOBS_DIR = jobsDirectory
 	config.SLEEP_TIME = 0
 
 	return ts, mux
 }
 
 func setupServerErrorImgSrc() (*httptest.Server, *http.ServeMux) {
+	return setupServerWithImgSrc("invalid image src")
+}
+
+func setupServerWithImgSrc(src string) (*httptest.Server, *http.ServeMux) {
 	mux := http.NewServeMux()
 	ts := httptest.NewServer(mux)
-	mux.HandleFunc("/page/{id}", returnHtmlHandler(testHtml(5, "invalid image src")))
-	mux.HandleFunc("/", returnHtmlHandler(testHtml(5, "invalid image src")))
+	mux.HandleFunc("/page/{id}", returnHtmlHandler(testHtml(5, src)))
+	mux.HandleFunc("/", returnHtmlHandler(testHtml(5, src)))
 	mux.HandleFunc("/download/image", imageHandler)
 
 	config.CARD_IMG_SELECTOR = "img"
 	config.MIN_CARDS_PER_PAGE = 5
 	config.SITE_URL = ts.URL
 	config.DOWNLOADS_SAVE_DIR = downloadsDirectory
+	config.JOBS_DIR = jobsDirectory
 	config.SLEEP_TIME = 0
 
 	return ts, mux
 }
 
 func setupCommonServer() (*httptest.Server, *http.ServeMux) {
+	return setupServerWithOverlappingPages(0, imageHandler)
+}
+
+func setupServerWithOverlappingPages(overlap int, imagesHandler http.HandlerFunc) (*httptest.Server, *http.ServeMux) {
 	mux := http.NewServeMux()
 	ts := httptest.NewServer(mux)
 	url := fmt.Sprintf("%s/download/image", ts.URL)
-	mux.HandleFunc("/page/{id}", returnHtmlHandler(testHtml(5, url)))
-	mux.HandleFunc("/", returnHtmlHandler(testHtml(5, url)))
-	mux.HandleFunc("/download/image", imageHandler)
+	mux.HandleFunc("/", returnPagesHandler(5, overlap, url))
+	mux.HandleFunc("/download/image/", imagesHandler)
 
 	config.CARD_IMG_SELECTOR = "img"
 	config.MIN_CARDS_PER_PAGE = 5
 	config.SITE_URL = ts.URL
 	config.DOWNLOADS_SAVE_DIR = downloadsDirectory
+	config.JOBS_DIR = jobsDirectory
+	config.SLEEP_TIME = 0
+
+	return ts, mux
+}
+
+func setupServerWithSrcset() (*httptest.Server, *http.ServeMux) {
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	content := `
+	<body>
+	<picture>
+		<source srcset="/download/image/big 1200w">
+		<img src="//` + strings.TrimPrefix(ts.URL, "http://") + `/download/image/thumb" srcset="/download/image/medium 600w">
+	</picture>
+	</body>`
+	mux.HandleFunc("/", returnHtmlHandler(content))
+	mux.HandleFunc("/download/image/", imageHandler)
+
+	config.CARD_IMG_SELECTOR = "img"
+	config.MIN_CARDS_PER_PAGE = 1
+	config.SITE_URL = ts.URL
+	config.DOWNLOADS_SAVE_DIR = downloadsDirectory
+	config.JOBS_DIR = jobsDirectory
 	config.SLEEP_TIME = 0
 
 	return ts, mux
 }
 
 func beforeAll() {
+	controller.LoadBrowsers()
 	_, err := os.Stat(downloadsDirectory)
 	if os.IsNotExist(err) {
 		os.Mkdir(downloadsDirectory, 0755)
@@ -109,7 +182,9 @@ func beforeAll() {
 }
 
 func afterAll() {
+	controller.CloseBrowsers()
 	os.RemoveAll(downloadsDirectory)
+	os.RemoveAll(jobsDirectory)
 }
 
 func cleanUpDownloads() {
@@ -133,12 +208,14 @@ func checkIfDownloadsAreOk(t *testing.T, numberOfDownloads int) {
 		t.Error(err)
 		return
 	}
-	if !utils.Assert(t, len(files), numberOfDownloads, "Invalid number of downloaded images") {
-		return
-	}
 	filesNames := []string{}
 	for _, file := range files {
-		filesNames = append(filesNames, file.Name())
+		if file.Name() != "manifest.json" {
+			filesNames = append(filesNames, file.Name())
+		}
+	}
+	if !utils.Assert(t, len(filesNames), numberOfDownloads, "Invalid number of downloaded images") {
+		return
 	}
 
 	for i := 0; i < numberOfDownloads; i += 1 {
@@ -163,7 +240,7 @@ func TestRetriveOneImage(t *testing.T) {
 	defer ts.Close()
 	ammount := 1
 	threads := 1
-	_, err := controller.GetImages(ammount, threads)
+	_, err := controller.GetImages(context.Background(), ammount, threads)
 	if err != nil {
 		t.Error("Error getting images: ", err)
 	}
@@ -176,7 +253,7 @@ func TestRetriveMultipleImages(t *testing.T) {
 	defer ts.Close()
 	ammount := 20
 	threads := 1
-	_, err := controller.GetImages(ammount, threads)
+	_, err := controller.GetImages(context.Background(), ammount, threads)
 	if err != nil {
 		t.Error("Error getting images: ", err)
 	}
@@ -189,7 +266,7 @@ func TestRetriveMultipleImagesWithMultipleThreads(t *testing.T) {
 	defer ts.Close()
 	ammount := 20
 	threads := 2
-	_, err := controller.GetImages(ammount, threads)
+	_, err := controller.GetImages(context.Background(), ammount, threads)
 	if err != nil {
 		t.Error("Error getting images: ", err)
 	}
@@ -203,7 +280,7 @@ func TestErrorOnInvalidSiteURL(t *testing.T) {
 	defer ts.Close()
 	ammount := 1
 	threads := 1
-	_, err := controller.GetImages(ammount, threads)
+	_, err := controller.GetImages(context.Background(), ammount, threads)
 	if err == nil {
 		t.Error("Expected error, got nil")
 	}
@@ -222,7 +299,7 @@ func TestErrorOnInvalidSaveDirectory(t *testing.T) {
 	defer ts.Close()
 	ammount := 1
 	threads := 1
-	_, err := controller.GetImages(ammount, threads)
+	_, err := controller.GetImages(context.Background(), ammount, threads)
 	if err == nil {
 		t.Error("Expected error, got nil")
 	}
@@ -240,7 +317,7 @@ func TestErrorOnInvalidImageSrc(t *testing.T) {
 	defer ts.Close()
 	ammount := 1
 	threads := 1
-	_, err := controller.GetImages(ammount, threads)
+	_, err := controller.GetImages(context.Background(), ammount, threads)
 	if err == nil {
 		t.Error("Expected error, got nil")
 	}
@@ -252,13 +329,44 @@ func TestErrorOnInvalidImageSrc(t *testing.T) {
 	}
 }
 
+func TestErrorOnInvalidAbsoluteImageSrc(t *testing.T) {
+	ts, _ := setupServerWithImgSrc("http://invalid image src")
+	defer cleanUpDownloads()
+	defer ts.Close()
+	_, err := controller.GetImages(context.Background(), 1, 1)
+	if _, ok := err.(*errors.ConnectionError); !ok {
+		t.Error("Expected a connection error, got: ", err)
+	}
+}
+
+func TestImagesAreDownloadedFromTheirSrc(t *testing.T) {
+	ts, mux := setupServerWithImgSrc("/download/signed?sig=2&exp=1&utm_source=test")
+	// like signed urls, the image is only served with the query as it was given
+	mux.HandleFunc("/download/signed", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "sig=2&exp=1&utm_source=test" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		imageHandler(w, r)
+	})
+	config.MIN_CARDS_PER_PAGE = 1
+	defer cleanUpDownloads()
+	defer ts.Close()
+	urls, err := controller.GetImages(context.Background(), 1, 1)
+	if err != nil {
+		t.Fatal("Error getting images: ", err)
+	}
+	utils.Assert(t, ts.URL+"/download/signed?sig=2&exp=1&utm_source=test", urls[0], "The src should be kept")
+	checkIfDownloadsAreOk(t, 1)
+}
+
 func TestErrorOnBodyWithNoImages(t *testing.T) {
 	ts, _ := setupServerWithBlankBody()
 	defer cleanUpDownloads()
 	defer ts.Close()
 	ammount := 1
 	threads := 1
-	_, err := controller.GetImages(ammount, threads)
+	_, err := controller.GetImages(context.Background(), ammount, threads)
 	if err == nil {
 		t.Error("Expected error, got nil")
 	}
@@ -269,3 +377,380 @@ func TestErrorOnBodyWithNoImages(t *testing.T) {
 		t.Error("Expected error has invalid type. NotFoundError was expected. Error received: ", e.Error())
 	}
 }
+
+func TestDuplicatedImagesAcrossPagesAreDownloadedOnce(t *testing.T) {
+	ts, _ := setupServerWithOverlappingPages(2, imageHandler)
+	defer cleanUpDownloads()
+	defer ts.Close()
+	ammount := 10
+	threads := 2
+	urls, err := controller.GetImages(context.Background(), ammount, threads)
+	if err != nil {
+		t.Error("Error getting images: ", err)
+		return
+	}
+	seen := []string{}
+	for _, url := range urls {
+		if utils.Contains(seen, url) {
+			t.Error("Duplicated url returned: ", url)
+			return
+		}
+		// tracking params are only ignored to compare the urls
+		if !strings.Contains(url, "utm_source") {
+			t.Error("The url should be downloaded as found on the page: ", url)
+			return
+		}
+		seen = append(seen, url)
+	}
+	checkIfDownloadsAreOk(t, ammount)
+}
+
+func TestNearDuplicatesAreDropped(t *testing.T) {
+	ts, _ := setupCommonServer()
+	config.DROP_NEAR_DUPLICATES = true
+	defer func() { config.DROP_NEAR_DUPLICATES = false }()
+	defer cleanUpDownloads()
+	defer ts.Close()
+	ammount := 3
+	threads := 1
+	// every url of the test server serves the same image
+	urls, err := controller.GetImages(context.Background(), ammount, threads)
+	if err != nil {
+		t.Error("Error getting images: ", err)
+		return
+	}
+	utils.Assert(t, 1, len(urls), "Invalid number of images after dropping near duplicates")
+	checkIfDownloadsAreOk(t, 1)
+
+	buf, err := ioutil.ReadFile(testDirectory + "/data/test_image.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes, err := imagehash.FromBytes(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images, err := controller.FindSimilarImages(hashes.PHash.String(), "phash", config.NEAR_DUPLICATE_DISTANCE)
+	if err != nil {
+		t.Error("Error finding similar images: ", err)
+		return
+	}
+	if utils.Assert(t, 1, len(images), "Invalid number of similar images") {
+		utils.Assert(t, 0, images[0].Distance, "The downloaded image should match its own hash")
+	}
+
+	// checkerboard pattern, unrelated to the test image
+	control := image.NewGray(image.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y += 1 {
+		for x := 0; x < 256; x += 1 {
+			if (x/16+y/16)%2 == 0 {
+				control.Set(x, y, color.White)
+			}
+		}
+	}
+	images, err = controller.FindSimilarImages(imagehash.PerceptionHash(control).String(), "phash", config.NEAR_DUPLICATE_DISTANCE)
+	if err != nil {
+		t.Error("Error finding similar images: ", err)
+		return
+	}
+	utils.Assert(t, 0, len(images), "An unrelated image shouldn't be similar")
+}
+
+func TestHighestResolutionImageIsSelected(t *testing.T) {
+	ts, _ := setupServerWithSrcset()
+	defer cleanUpDownloads()
+	defer ts.Close()
+	ammount := 1
+	threads := 1
+	urls, err := controller.GetImages(context.Background(), ammount, threads)
+	if err != nil {
+		t.Error("Error getting images: ", err)
+		return
+	}
+	utils.Assert(t, ts.URL+"/download/image/big", urls[0], "Invalid image resolution selected")
+	checkIfDownloadsAreOk(t, ammount)
+}
+
+func TestCapturedImagesAreNotRequestedAgain(t *testing.T) {
+	var mu sync.Mutex
+	imageRequests := map[string]int{}
+	ts, _ := setupServerWithOverlappingPages(0, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		imageRequests[r.URL.Path] += 1
+		mu.Unlock()
+		imageHandler(w, r)
+	})
+	config.CAPTURE_IMAGES_ON_DISCOVERY = true
+	defer func() { config.CAPTURE_IMAGES_ON_DISCOVERY = false }()
+	defer cleanUpDownloads()
+	defer ts.Close()
+
+	ammount := 5
+	threads := 1
+	_, err := controller.GetImages(context.Background(), ammount, threads)
+	if err != nil {
+		t.Error("Error getting images: ", err)
+		return
+	}
+	checkIfDownloadsAreOk(t, ammount)
+	for path, count := range imageRequests {
+		utils.Assert(t, 1, count, "Image requested more than once: "+path)
+	}
+}
+
+func TestBlockedRequestsDontReachTheSite(t *testing.T) {
+	var mu sync.Mutex
+	adRequests := 0
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	mux.HandleFunc("/", returnHtmlHandler(`<script src="/ads/banner.js"></script>`+testHtml(5, "/download/image")))
+	mux.HandleFunc("/download/image", imageHandler)
+	mux.HandleFunc("/ads/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		adRequests += 1
+		mu.Unlock()
+	})
+	config.CARD_IMG_SELECTOR = "img"
+	config.MIN_CARDS_PER_PAGE = 5
+	config.SITE_URL = ts.URL
+	config.DOWNLOADS_SAVE_DIR = downloadsDirectory
+	config.JOBS_DIR = jobsDirectory
+	config.SLEEP_TIME = 0
+	blockResources, patterns := config.BLOCK_RESOURCES, config.BLOCKED_URL_PATTERNS
+	defer func() { config.BLOCK_RESOURCES, config.BLOCKED_URL_PATTERNS = blockResources, patterns }()
+	config.BLOCKED_URL_PATTERNS = []string{"*/ads/*"}
+	defer cleanUpDownloads()
+	defer ts.Close()
+
+	for _, block := range []bool{true, false} {
+		config.BLOCK_RESOURCES = block
+		if _, err := controller.GetImages(context.Background(), 1, 1); err != nil {
+			t.Fatal("Error getting images: ", err)
+		}
+		mu.Lock()
+		requests := adRequests
+		mu.Unlock()
+		if block {
+			utils.Assert(t, 0, requests, "The blocked script shouldn't reach the site")
+		} else if requests == 0 {
+			t.Error("The script should be requested when the resources aren't blocked")
+		}
+	}
+}
+
+func TestTimeoutError(t *testing.T) {
+	ts, mux := setupServerWithBlankBody()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+	})
+	defer cleanUpDownloads()
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := controller.GetImages(ctx, 1, 1)
+	switch e := err.(type) {
+	case *errors.TimeoutError:
+		return
+	default:
+		t.Error("Expected timeout error, got: ", e)
+	}
+}
+
+func TestErrorOnTooManyThreads(t *testing.T) {
+	ts, _ := setupCommonServer()
+	defer cleanUpDownloads()
+	defer ts.Close()
+	_, err := controller.GetImages(context.Background(), 1, config.CONCURRENCY_MAX+1)
+	switch e := err.(type) {
+	case *errors.InvalidParametersError:
+		return
+	default:
+		t.Error("Expected invalid parameters error, got: ", e)
+	}
+}
+
+func TestRetryThrottledPages(t *testing.T) {
+	var mu sync.Mutex
+	throttled := false
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer cleanUpDownloads()
+	defer ts.Close()
+	pagesHandler := returnPagesHandler(5, 0, fmt.Sprintf("%s/download/image", ts.URL))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		throttle := pageNumber(r) == 2 && !throttled
+		throttled = throttled || throttle
+		mu.Unlock()
+		if throttle {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		pagesHandler(w, r)
+	})
+	mux.HandleFunc("/download/image/", imageHandler)
+	config.CARD_IMG_SELECTOR = "img"
+	config.MIN_CARDS_PER_PAGE = 5
+	config.SITE_URL = ts.URL
+	config.DOWNLOADS_SAVE_DIR = downloadsDirectory
+	config.JOBS_DIR = jobsDirectory
+	config.SLEEP_TIME = 0
+
+	ammount := 10
+	threads := 2
+	urls, err := controller.GetImages(context.Background(), ammount, threads)
+	if err != nil {
+		t.Error("Error getting images: ", err)
+		return
+	}
+	utils.Assert(t, ammount, len(urls), "Invalid number of urls")
+	checkIfDownloadsAreOk(t, ammount)
+}
+
+func TestNewImagesStopAtTheFirstSeenMeme(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[int]int{}
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer cleanUpDownloads()
+	defer ts.Close()
+	imagesUrl := fmt.Sprintf("%s/download/image", ts.URL)
+	pagesHandler := returnPagesHandler(5, 0, imagesUrl)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		page := pageNumber(r)
+		mu.Lock()
+		requests[page] += 1
+		throttle := page == 2 && requests[page] == 1
+		mu.Unlock()
+		if throttle {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		pagesHandler(w, r)
+	})
+	mux.HandleFunc("/download/image/", imageHandler)
+	config.CARD_IMG_SELECTOR = "img"
+	config.MIN_CARDS_PER_PAGE = 5
+	config.SITE_URL = ts.URL
+	config.DOWNLOADS_SAVE_DIR = downloadsDirectory
+	config.JOBS_DIR = jobsDirectory
+	config.SLEEP_TIME = 0
+
+	// the third image of page 3 was seen before since, the first one of page 1 after it
+	catalogDb := config.CATALOG_DB
+	defer func() { config.CATALOG_DB = catalogDb }()
+	config.CATALOG_DB = filepath.Join(t.TempDir(), "catalog.db")
+	prefilled, err := catalogpkg.Open(config.CATALOG_DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC)
+	prefilled.Add([]catalogpkg.Entry{{Url: fmt.Sprintf("%s/12?utm_source=test", imagesUrl)}}, since.Add(-24*time.Hour))
+	prefilled.Add([]catalogpkg.Entry{{Url: fmt.Sprintf("%s/0?utm_source=test", imagesUrl)}}, since.Add(24*time.Hour))
+	prefilled.Close()
+	if err := controller.OpenCatalog(); err != nil {
+		t.Fatal(err)
+	}
+	defer controller.CloseCatalog()
+
+	// one thread, so the page after the seen meme can only start once it's found
+	urls, err := controller.GetNewImages(context.Background(), "2022-01-31", 100, 1)
+	if err != nil {
+		t.Fatal("Error getting images: ", err)
+	}
+	expected := []string{}
+	for i := 0; i < 12; i += 1 {
+		expected = append(expected, fmt.Sprintf("%s/%d", imagesUrl, i))
+	}
+	res := []string{}
+	for _, url := range urls {
+		res = append(res, strings.Split(url, "?")[0])
+	}
+	utils.Assert(t, strings.Join(expected, "\n"), strings.Join(res, "\n"), "The images should be the ones before the first seen meme")
+	checkIfDownloadsAreOk(t, 12)
+	mu.Lock()
+	defer mu.Unlock()
+	utils.Assert(t, 2, requests[2], "The throttled page before the seen meme should be retried")
+	utils.Assert(t, 1, requests[3], "Invalid requests of page 3")
+	for page := range requests {
+		if page > 3 {
+			t.Error("The pages after the seen meme shouldn't be scraped, requested: ", page)
+		}
+	}
+}
+
+func TestResumeInterruptedJob(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	defer cleanUpDownloads()
+	defer ts.Close()
+	pagesHandler := returnPagesHandler(5, 0, fmt.Sprintf("%s/download/image", ts.URL))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path] += 1
+		mu.Unlock()
+		if strings.HasPrefix(r.URL.Path, "/download/image/") {
+			imageHandler(w, r)
+			return
+		}
+		pagesHandler(w, r)
+	})
+	config.CARD_IMG_SELECTOR = "img"
+	config.MIN_CARDS_PER_PAGE = 5
+	config.SITE_URL = ts.URL
+	config.DOWNLOADS_SAVE_DIR = downloadsDirectory
+	config.JOBS_DIR = jobsDirectory
+	config.SLEEP_TIME = 0
+
+	// the first page was scraped, and its third image saved, before the interruption
+	directory := downloadsDirectory + "/resumed"
+	os.Mkdir(directory, 0755)
+	image, _ := ioutil.ReadFile(testDirectory + "/data/test_image.jpg")
+	ioutil.WriteFile(directory+"/1.jpg", image, 0644)
+	firstPage := []string{}
+	for i := 0; i < 5; i += 1 {
+		firstPage = append(firstPage, fmt.Sprintf("%s/download/image/%d", ts.URL, i))
+	}
+	state := controller.JobState{
+		ID:        "0123456789abcdef",
+		Site:      ts.URL,
+		Amount:    10,
+		Threads:   1,
+		Status:    controller.JobInterrupted,
+		Pages:     map[int][]string{1: firstPage},
+		Directory: directory,
+		Images:    []controller.ImageRecord{{Url: firstPage[2], File: "1.jpg"}},
+	}
+	payload, _ := json.Marshal(&state)
+	os.MkdirAll(jobsDirectory, 0755)
+	ioutil.WriteFile(jobsDirectory+"/"+state.ID+".json", payload, 0644)
+
+	urls, err := controller.ResumeJob(context.Background(), state.ID)
+	if err != nil {
+		t.Error("Error resuming the job: ", err)
+		return
+	}
+	utils.Assert(t, 10, len(urls), "Invalid number of urls")
+	utils.Assert(t, 0, requests["/"], "The scraped page was requested again")
+	utils.Assert(t, 1, requests["/page/2"], "The missing page wasn't requested")
+	utils.Assert(t, 0, requests["/download/image/2"], "The saved image was requested again")
+	checkIfDownloadsAreOk(t, 10)
+	// the new images are saved after the one of the first run, without overwriting it
+	payload, _ = ioutil.ReadFile(directory + "/manifest.json")
+	var manifest controller.Manifest
+	json.Unmarshal(payload, &manifest)
+	files := map[string]string{}
+	for _, record := range manifest.Images {
+		if url, ok := files[record.File]; ok {
+			t.Errorf("Images %s and %s were saved in the same file %s", url, record.Url, record.File)
+		}
+		files[record.File] = record.Url
+	}
+	utils.Assert(t, firstPage[2], files["1.jpg"], "The saved image was overwritten")
+	if _, err := os.Stat(jobsDirectory + "/" + state.ID + ".json"); !os.IsNotExist(err) {
+		t.Error("The state of the finished job wasn't removed")
+	}
+}
@@ -0,0 +1,218 @@
+package images
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+
+	config "propper/configs"
+	cookiejar "propper/lib/cookiejar"
+	logger "propper/lib/logger"
+)
+
+// Settings of a site in SITES_CONFIG_FILE.
+type siteSettings struct {
+	UserAgent string            `json:"user_agent"`
+	Headers   map[string]string `json:"headers"`
+	// Netscape cookies.txt file imported into the jar of the site
+	CookiesFile string `json:"cookies_file"`
+}
+
+type site struct {
+	host     string
+	settings siteSettings
+	jar      *cookiejar.Jar
+}
+
+// Configured sites, by host. None until LoadSites is called.
+var sites = map[string]*site{}
+
+// Loads the sites of SITES_CONFIG_FILE. Must be called on startup, before any job starts.
+func LoadSites() error {
+	res, err := loadSites(config.SITES_CONFIG_FILE)
+	if err != nil {
+		return err
+	}
+	sites = res
+	return nil
+}
+
+func loadSites(path string) (map[string]*site, error) {
+	res := map[string]*site{}
+	if len(path) == 0 {
+		return res, nil
+	}
+	payload, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	settingsByHost := map[string]siteSettings{}
+	if err := json.Unmarshal(payload, &settingsByHost); err != nil {
+		return nil, fmt.Errorf("invalid sites config '%s': %w", path, err)
+	}
+	for host, settings := range settingsByHost {
+		s, err := newSite(strings.ToLower(host), settings)
+		if err != nil {
+			return nil, err
+		}
+		res[strings.ToLower(host)] = s
+	}
+	return res, nil
+}
+
+// The jar is saved in COOKIE_JAR_DIR, or only kept in memory if it isn't set.
+func newSite(host string, settings siteSettings) (*site, error) {
+	jarPath := ""
+	if len(config.COOKIE_JAR_DIR) > 0 {
+		if err := os.MkdirAll(config.COOKIE_JAR_DIR, 0700); err != nil {
+			return nil, err
+		}
+		jarPath = filepath.Join(config.COOKIE_JAR_DIR, host+".json")
+	}
+	jar, err := cookiejar.Load(jarPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(settings.CookiesFile) > 0 {
+		file, err := os.Open(settings.CookiesFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		imported, err := cookiejar.ParseNetscape(file)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cookies file '%s': %w", settings.CookiesFile, err)
+		}
+		jar.Merge(imported)
+	}
+	return &site{host: host, settings: settings, jar: jar}, nil
+}
+
+// Whether the requests of the tabs must be intercepted to add the headers of the site.
+func (s *site) hasHeaders() bool {
+	return s != nil && len(s.settings.Headers) > 0
+}
+
+// Headers of an intercepted request to rawUrl, with the extra headers of the
+// site. They can carry credentials, so they are only added to the requests to
+// the site's host, not to the CDNs or ads its pages load. Returns false if the
+// request must keep its headers.
+func (s *site) requestHeaders(rawUrl string, original network.Headers) ([]*fetch.HeaderEntry, bool) {
+	if !s.hasHeaders() {
+		return nil, false
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil || strings.ToLower(u.Hostname()) != s.host {
+		return nil, false
+	}
+	res := []*fetch.HeaderEntry{}
+	replaced := map[string]bool{}
+	for name, value := range s.settings.Headers {
+		res = append(res, &fetch.HeaderEntry{Name: name, Value: value})
+		replaced[strings.ToLower(name)] = true
+	}
+	for name, value := range original {
+		if !replaced[strings.ToLower(name)] {
+			res = append(res, &fetch.HeaderEntry{Name: name, Value: fmt.Sprint(value)})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, true
+}
+
+// Returns the settings of the site of rawUrl, or nil if it isn't configured.
+func siteOf(rawUrl string) *site {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil
+	}
+	return sites[strings.ToLower(u.Hostname())]
+}
+
+// Sets the user agent and cookies of the site in the tab. Does nothing for a
+// nil site. Must run before navigating. The extra headers are added by
+// enableInterception.
+func applySite(s *site) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		if s == nil {
+			return nil
+		}
+		if len(s.settings.UserAgent) > 0 {
+			if err := emulation.SetUserAgentOverride(s.settings.UserAgent).Do(ctx); err != nil {
+				return err
+			}
+		}
+		params := []*network.CookieParam{}
+		for _, cookie := range s.jar.Cookies() {
+			param := &network.CookieParam{
+				Name:     cookie.Name,
+				Value:    cookie.Value,
+				Domain:   cookie.Domain,
+				Path:     cookie.Path,
+				Secure:   cookie.Secure,
+				HTTPOnly: cookie.HttpOnly,
+			}
+			if !cookie.Expires.IsZero() {
+				expires := cdp.TimeSinceEpoch(cookie.Expires)
+				param.Expires = &expires
+			}
+			params = append(params, param)
+		}
+		if len(params) == 0 {
+			return nil
+		}
+		return network.SetCookies(params).Do(ctx)
+	})
+}
+
+// Stores in the jar of the site the cookies the tab has for pageUrl, so the
+// ones set by the site while scraping are kept for the next requests.
+func collectCookies(ctx context.Context, s *site, pageUrl string) {
+	if s == nil {
+		return
+	}
+	cookies, err := network.GetCookies().WithUrls([]string{pageUrl}).Do(ctx)
+	if err != nil {
+		logger.Warn(ctx, "Couldn't read the cookies of the tab", "error", err)
+		return
+	}
+	collected := []cookiejar.Cookie{}
+	for _, cookie := range cookies {
+		expires := time.Time{}
+		if !cookie.Session && cookie.Expires > 0 {
+			expires = time.Unix(int64(cookie.Expires), 0).UTC()
+		}
+		collected = append(collected, cookiejar.Cookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HTTPOnly,
+			Expires:  expires,
+		})
+	}
+	s.jar.Merge(collected)
+}
+
+func saveCookies(ctx context.Context, s *site) {
+	if s == nil {
+		return
+	}
+	if err := s.jar.Save(); err != nil {
+		logger.Error(ctx, "Couldn't save the cookie jar", "error", err)
+	}
+}
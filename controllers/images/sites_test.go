@@ -0,0 +1,95 @@
+package images
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+
+	config "propper/configs"
+	utils "propper/test/utils"
+)
+
+func TestLoadSites(t *testing.T) {
+	dir := t.TempDir()
+	cookiesPath := filepath.Join(dir, "cookies.txt")
+	err := ioutil.WriteFile(cookiesPath, []byte(".example.com\tTRUE\t/\tFALSE\t0\tconsent\tyes\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sitesPath := filepath.Join(dir, "sites.json")
+	err = ioutil.WriteFile(sitesPath, []byte(`{"Example.com": {"user_agent": "test-agent", "headers": {"X-Test": "1"}, "cookies_file": "`+cookiesPath+`"}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookieJarDir, sitesConfigFile := config.COOKIE_JAR_DIR, config.SITES_CONFIG_FILE
+	defer func() {
+		config.COOKIE_JAR_DIR, config.SITES_CONFIG_FILE = cookieJarDir, sitesConfigFile
+		sites = map[string]*site{}
+	}()
+	config.COOKIE_JAR_DIR = ""
+	config.SITES_CONFIG_FILE = sitesPath
+
+	if err := LoadSites(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := siteOf("https://EXAMPLE.com/page/2")
+	if s == nil {
+		t.Fatal("Expected the settings of the configured host")
+	}
+	utils.Assert(t, "test-agent", s.settings.UserAgent, "Invalid user agent")
+	utils.Assert(t, "1", s.settings.Headers["X-Test"], "Invalid header")
+	cookies := s.jar.Cookies()
+	utils.Assert(t, 1, len(cookies), "Invalid number of imported cookies")
+	utils.Assert(t, "consent", cookies[0].Name, "Invalid imported cookie")
+
+	if siteOf("https://other.com") != nil {
+		t.Error("Expected no settings for a host that isn't configured")
+	}
+}
+
+func TestLoadSitesRejectsInvalidConfig(t *testing.T) {
+	sitesPath := filepath.Join(t.TempDir(), "sites.json")
+	if err := ioutil.WriteFile(sitesPath, []byte(`{"example.com": `), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSites(sitesPath); err == nil {
+		t.Error("Expected an error for an invalid config")
+	}
+	if _, err := loadSites(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected an error for a missing config")
+	}
+}
+
+func TestSiteHeadersOnlyGoToItsHost(t *testing.T) {
+	s := &site{host: "example.com", settings: siteSettings{Headers: map[string]string{"Authorization": "Bearer secret"}}}
+	original := network.Headers{"Accept": "image/*", "authorization": "none"}
+
+	headers, ok := s.requestHeaders("https://EXAMPLE.com/page/2", original)
+	if !ok {
+		t.Fatal("Expected the headers of the site for its host")
+	}
+	utils.Assert(t, "[Accept=image/* Authorization=Bearer secret]", fmt.Sprint(headerStrings(headers)), "Invalid headers")
+
+	for _, rawUrl := range []string{"https://cdn.example.net/1.jpg", "https://ads.example.com/pixel", "invalid url%"} {
+		if _, ok := s.requestHeaders(rawUrl, original); ok {
+			t.Error("The headers of the site shouldn't be sent to ", rawUrl)
+		}
+	}
+	var none *site
+	if _, ok := none.requestHeaders("https://example.com", original); ok {
+		t.Error("Requests without a site should keep their headers")
+	}
+}
+
+func headerStrings(headers []*fetch.HeaderEntry) []string {
+	res := []string{}
+	for _, header := range headers {
+		res = append(res, header.Name+"="+header.Value)
+	}
+	return res
+}
@@ -0,0 +1,161 @@
+package images
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chromedp/cdproto/cdp"
+)
+
+const (
+	preferLargest  = "largest"
+	preferSmallest = "smallest"
+	preferClosest  = "closest"
+)
+
+// Image url from a srcset with its descriptor. Only one of Width ("480w")
+// or Density ("2x") is set, a candidate without descriptors has density 1.
+type srcCandidate struct {
+	Url     string
+	Width   int
+	Density float64
+}
+
+// Parses the value of a srcset attribute. Urls can contain commas, so the
+// candidates are split as the html spec does: a url ends on whitespace, and
+// its descriptors end on a comma.
+func parseSrcset(srcset string) []srcCandidate {
+	candidates := []srcCandidate{}
+	rest := srcset
+	for {
+		rest = strings.TrimLeft(rest, " \t\n\r\f,")
+		if len(rest) == 0 {
+			return candidates
+		}
+		end := strings.IndexAny(rest, " \t\n\r\f")
+		if end == -1 {
+			end = len(rest)
+		}
+		url := rest[:end]
+		rest = rest[end:]
+
+		descriptors := ""
+		// a url ending in commas has no descriptors
+		if strings.HasSuffix(url, ",") {
+			url = strings.TrimRight(url, ",")
+		} else {
+			end = strings.Index(rest, ",")
+			if end == -1 {
+				end = len(rest)
+			}
+			descriptors = rest[:end]
+			rest = rest[end:]
+		}
+
+		candidate := srcCandidate{Url: url, Density: 1}
+		valid := true
+		for _, descriptor := range strings.Fields(descriptors) {
+			value := descriptor[:len(descriptor)-1]
+			switch descriptor[len(descriptor)-1] {
+			case 'w':
+				width, err := strconv.Atoi(value)
+				valid = valid && err == nil && width > 0
+				candidate.Width, candidate.Density = width, 0
+			case 'x':
+				density, err := strconv.ParseFloat(value, 64)
+				valid = valid && err == nil && density > 0
+				candidate.Density = density
+			}
+		}
+		if valid && len(url) > 0 {
+			candidates = append(candidates, candidate)
+		}
+	}
+}
+
+// Picks the candidate that fits best the preference. Candidates with width
+// descriptors are compared by width, if there are none by density. When
+// looking for the closest one to targetWidth without widths, the 1x candidate is chosen.
+func selectCandidate(candidates []srcCandidate, preference string, targetWidth int) (srcCandidate, bool) {
+	if len(candidates) == 0 {
+		return srcCandidate{}, false
+	}
+	withWidth := []srcCandidate{}
+	for _, candidate := range candidates {
+		if candidate.Width > 0 {
+			withWidth = append(withWidth, candidate)
+		}
+	}
+	size := func(c srcCandidate) float64 {
+		return c.Density
+	}
+	target := 1.0
+	if len(withWidth) > 0 {
+		candidates = withWidth
+		size = func(c srcCandidate) float64 {
+			return float64(c.Width)
+		}
+		target = float64(targetWidth)
+	}
+
+	sorted := append([]srcCandidate{}, candidates...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return size(sorted[i]) < size(sorted[j])
+	})
+	switch preference {
+	case preferLargest:
+		return sorted[len(sorted)-1], true
+	case preferSmallest:
+		return sorted[0], true
+	case preferClosest:
+		best := sorted[0]
+		for _, candidate := range sorted[1:] {
+			if abs(size(candidate)-target) < abs(size(best)-target) {
+				best = candidate
+			}
+		}
+		return best, true
+	}
+	// unknown preferences fall back to the largest image
+	return sorted[len(sorted)-1], true
+}
+
+func abs(val float64) float64 {
+	if val < 0 {
+		return -val
+	}
+	return val
+}
+
+// Srcset candidates of the node, and of the <source> elements when the node
+// is inside a <picture>.
+func srcsetCandidatesOfNode(node *cdp.Node) []srcCandidate {
+	candidates := []srcCandidate{}
+	for _, attribute := range []string{"data-srcset", "srcset"} {
+		if srcset, exists := node.Attribute(attribute); exists {
+			candidates = append(candidates, parseSrcset(srcset)...)
+		}
+	}
+
+	parent := node.Parent
+	if parent == nil {
+		return candidates
+	}
+	parent.RLock()
+	defer parent.RUnlock()
+	if parent.LocalName != "picture" {
+		return candidates
+	}
+	for _, sibling := range parent.Children {
+		if sibling.LocalName != "source" {
+			continue
+		}
+		for _, attribute := range []string{"data-srcset", "srcset"} {
+			if srcset, exists := sibling.Attribute(attribute); exists {
+				candidates = append(candidates, parseSrcset(srcset)...)
+			}
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,54 @@
+package images
+
+import (
+	"testing"
+
+	utils "propper/test/utils"
+)
+
+func TestParseSrcset(t *testing.T) {
+	candidates := parseSrcset(" small.jpg 320w,\n https://cdn.example.com/f_auto,w_800/big.jpg 800w, medium.jpg 480w")
+	if !utils.Assert(t, 3, len(candidates), "Invalid number of candidates") {
+		return
+	}
+	utils.Assert(t, "small.jpg", candidates[0].Url, "Invalid url")
+	utils.Assert(t, 320, candidates[0].Width, "Invalid width")
+	utils.Assert(t, "https://cdn.example.com/f_auto,w_800/big.jpg", candidates[1].Url, "Invalid url with commas")
+	utils.Assert(t, 800, candidates[1].Width, "Invalid width")
+
+	candidates = parseSrcset("a.jpg, b.jpg 2x, c.jpg 1.5x, d.jpg 0x")
+	if !utils.Assert(t, 3, len(candidates), "Invalid number of candidates") {
+		return
+	}
+	utils.Assert(t, 1.0, candidates[0].Density, "Invalid default density")
+	utils.Assert(t, 2.0, candidates[1].Density, "Invalid density")
+	utils.Assert(t, 1.5, candidates[2].Density, "Invalid density")
+}
+
+func TestSelectCandidate(t *testing.T) {
+	byWidth := parseSrcset("a.jpg 320w, b.jpg 1200w, c.jpg 700w")
+	byDensity := parseSrcset("x1.jpg, x3.jpg 3x, x2.jpg 2x")
+	cases := []struct {
+		candidates []srcCandidate
+		preference string
+		expected   string
+	}{
+		{byWidth, preferLargest, "b.jpg"},
+		{byWidth, preferSmallest, "a.jpg"},
+		{byWidth, preferClosest, "c.jpg"},
+		{byDensity, preferLargest, "x3.jpg"},
+		{byDensity, preferSmallest, "x1.jpg"},
+		{byDensity, preferClosest, "x1.jpg"},
+	}
+	for _, c := range cases {
+		candidate, ok := selectCandidate(c.candidates, c.preference, 800)
+		if !ok {
+			t.Error("Expected a candidate for preference ", c.preference)
+			continue
+		}
+		utils.Assert(t, c.expected, candidate.Url, "Invalid candidate for preference "+c.preference)
+	}
+	if _, ok := selectCandidate(nil, preferLargest, 800); ok {
+		t.Error("Expected no candidate")
+	}
+}
@@ -0,0 +1,49 @@
+package images
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+
+	config "propper/configs"
+)
+
+// Time the Retry-After header of a throttled response asks to wait, in
+// seconds or as a date, or 0 if it doesn't have a valid one.
+func retryAfterOf(headers network.Headers, now time.Time) time.Duration {
+	for name, value := range headers {
+		if !strings.EqualFold(name, "Retry-After") {
+			continue
+		}
+		text, ok := value.(string)
+		if !ok {
+			return 0
+		}
+		text = strings.TrimSpace(text)
+		if seconds, err := strconv.Atoi(text); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		if date, err := http.ParseTime(text); err == nil && date.After(now) {
+			return date.Sub(now)
+		}
+		return 0
+	}
+	return 0
+}
+
+// Time before scraping again a page throttled for the nth time. The
+// Retry-After of the site is used if it sent one, otherwise THROTTLE_RETRY_DELAY
+// doubles on each retry.
+func throttleDelay(retries int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	// stops doubling after 10 retries, so the delay can't overflow
+	if retries > 10 {
+		retries = 10
+	}
+	return time.Duration(config.THROTTLE_RETRY_DELAY) * time.Millisecond << (retries - 1)
+}
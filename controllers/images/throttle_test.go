@@ -0,0 +1,42 @@
+package images
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+
+	config "propper/configs"
+	utils "propper/test/utils"
+)
+
+func TestRetryAfterOf(t *testing.T) {
+	now := time.Date(2022, 1, 31, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		headers  network.Headers
+		expected time.Duration
+	}{
+		{network.Headers{"Retry-After": "120"}, 2 * time.Minute},
+		{network.Headers{"retry-after": "5"}, 5 * time.Second},
+		{network.Headers{"Retry-After": "Mon, 31 Jan 2022 12:00:30 GMT"}, 30 * time.Second},
+		// dates in the past, and invalid values, don't ask to wait
+		{network.Headers{"Retry-After": "Mon, 31 Jan 2022 11:00:00 GMT"}, 0},
+		{network.Headers{"Retry-After": "soon"}, 0},
+		{network.Headers{"Retry-After": "-1"}, 0},
+		{network.Headers{"Content-Type": "text/html"}, 0},
+		{nil, 0},
+	} {
+		utils.Assert(t, test.expected, retryAfterOf(test.headers, now), "Invalid delay")
+	}
+}
+
+func TestThrottleDelay(t *testing.T) {
+	delay := config.THROTTLE_RETRY_DELAY
+	defer func() { config.THROTTLE_RETRY_DELAY = delay }()
+	config.THROTTLE_RETRY_DELAY = 100
+
+	utils.Assert(t, 100*time.Millisecond, throttleDelay(1, 0), "Invalid delay of the first retry")
+	utils.Assert(t, 400*time.Millisecond, throttleDelay(3, 0), "The delay should double on each retry")
+	utils.Assert(t, 100*512*time.Millisecond, throttleDelay(100, 0), "The delay should stop doubling")
+	utils.Assert(t, 3*time.Second, throttleDelay(3, 3*time.Second), "The Retry-After of the site should be used")
+}
@@ -0,0 +1,90 @@
+package images
+
+import (
+	"net/url"
+	"strings"
+
+	config "propper/configs"
+)
+
+// Resolves the given src against the url of the page where it was found,
+// without changing it otherwise, as signed urls break when their query
+// changes. Returns false if the src can't be used as an image url.
+func resolveImageURL(pageUrl, src string) (*url.URL, bool) {
+	src = strings.TrimSpace(src)
+	// urls can't contain whitespace, and the page would have to escape it
+	if len(src) == 0 || strings.HasPrefix(src, "data:") || strings.ContainsAny(src, " \t\n\r") {
+		return nil, false
+	}
+	base, err := url.Parse(pageUrl)
+	if err != nil {
+		return nil, false
+	}
+	ref, err := url.Parse(src)
+	if err != nil {
+		return nil, false
+	}
+	u := base.ResolveReference(ref)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, false
+	}
+	return u, true
+}
+
+// Resolves the given src against the url of the page where it was found and
+// returns it in a canonical form, so the same image referenced in different
+// ways compares equal. Returns false if the src can't be used as an image url.
+// The canonical form is only used to compare the images, they are downloaded
+// from their resolved src.
+func normalizeImageURL(pageUrl, src string) (string, bool) {
+	u, ok := resolveImageURL(pageUrl, src)
+	if !ok {
+		return "", false
+	}
+
+	u.Fragment = ""
+	host := strings.ToLower(u.Hostname())
+	if canonical, ok := config.CDN_HOST_ALIASES[host]; ok {
+		host = canonical
+	}
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	u.Host = host
+	if len(port) > 0 {
+		u.Host = host + ":" + port
+	}
+
+	query := u.Query()
+	for _, param := range config.TRACKING_QUERY_PARAMS {
+		query.Del(param)
+	}
+	// Encode sorts the keys, so the order of the params doesn't matter
+	u.RawQuery = query.Encode()
+	return u.String(), true
+}
+
+// Key to compare the image src found on the page at pageUrl with the rest:
+// its normalized url, or the src itself if it isn't a valid url.
+func imageKey(pageUrl, src string) string {
+	if key, ok := normalizeImageURL(pageUrl, src); ok {
+		return key
+	}
+	return src
+}
+
+// Returns the urls without the ones whose key already appeared, keeping the
+// order of their first appearance. keys[i] is the key of urls[i].
+func uniqueURLs(urls, keys []string) []string {
+	seen := map[string]bool{}
+	res := []string{}
+	for i, u := range urls {
+		if seen[keys[i]] {
+			continue
+		}
+		seen[keys[i]] = true
+		res = append(res, u)
+	}
+	return res
+}
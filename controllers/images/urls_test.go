@@ -0,0 +1,92 @@
+package images
+
+import (
+	"testing"
+
+	config "propper/configs"
+	utils "propper/test/utils"
+)
+
+func TestNormalizeImageURL(t *testing.T) {
+	aliases := config.CDN_HOST_ALIASES
+	defer func() { config.CDN_HOST_ALIASES = aliases }()
+	config.CDN_HOST_ALIASES = map[string]string{"cdn2.example.com": "cdn.example.com"}
+	pageUrl := "https://example.com/page/2"
+	cases := map[string]string{
+		"https://cdn.example.com/a.jpg":          "https://cdn.example.com/a.jpg",
+		"/a.jpg":                                 "https://example.com/a.jpg",
+		"a.jpg":                                  "https://example.com/page/a.jpg",
+		"//cdn.example.com/a.jpg":                "https://cdn.example.com/a.jpg",
+		"https://CDN2.example.com:443/a.jpg#top": "https://cdn.example.com/a.jpg",
+		"https://cdn.example.com/a.jpg?utm_source=x&w=2&id=1": "https://cdn.example.com/a.jpg?id=1&w=2",
+	}
+	for src, expected := range cases {
+		res, ok := normalizeImageURL(pageUrl, src)
+		if !ok {
+			t.Error("Unexpected invalid url: ", src)
+			continue
+		}
+		utils.Assert(t, expected, res, "Invalid normalized url for "+src)
+	}
+
+	for _, src := range []string{"", "data:image/png;base64,AAAA", "javascript:void(0)"} {
+		if _, ok := normalizeImageURL(pageUrl, src); ok {
+			t.Error("Expected invalid url: ", src)
+		}
+	}
+}
+
+func TestUniqueURLsKeepsOrder(t *testing.T) {
+	res := uniqueURLs([]string{"a", "b", "a", "c", "b"}, []string{"a", "b", "a", "c", "b"})
+	if !utils.Assert(t, 3, len(res), "Invalid number of unique urls") {
+		return
+	}
+	utils.Assert(t, "a", res[0], "Invalid order")
+	utils.Assert(t, "b", res[1], "Invalid order")
+	utils.Assert(t, "c", res[2], "Invalid order")
+}
+
+func TestResolveImageURLKeepsTheSrc(t *testing.T) {
+	pageUrl := "https://example.com/page/2"
+	cases := map[string]string{
+		"https://CDN.example.com/a.jpg?sig=2&exp=1&utm_source=x": "https://CDN.example.com/a.jpg?sig=2&exp=1&utm_source=x",
+		"/a.jpg":                  "https://example.com/a.jpg",
+		"//cdn.example.com/a.jpg": "https://cdn.example.com/a.jpg",
+	}
+	for src, expected := range cases {
+		u, ok := resolveImageURL(pageUrl, src)
+		if !ok {
+			t.Error("Unexpected invalid url: ", src)
+			continue
+		}
+		utils.Assert(t, expected, u.String(), "Invalid resolved url for "+src)
+	}
+	for _, src := range []string{"invalid image src", "http://invalid image src", "data:image/png;base64,AAAA"} {
+		if _, ok := resolveImageURL(pageUrl, src); ok {
+			t.Error("Expected invalid url: ", src)
+		}
+	}
+}
+
+func TestUniqueURLsKeepsTheOriginalSrc(t *testing.T) {
+	trackingParams := config.TRACKING_QUERY_PARAMS
+	defer func() { config.TRACKING_QUERY_PARAMS = trackingParams }()
+	config.TRACKING_QUERY_PARAMS = []string{"utm_source"}
+	pageUrl := "https://example.com/page/2"
+	srcs := []string{
+		"https://cdn.example.com/a.jpg?sig=2&exp=1&utm_source=x",
+		"https://cdn.example.com/a.jpg?exp=1&sig=2",
+		"/b.jpg",
+	}
+	keys := []string{}
+	for _, src := range srcs {
+		keys = append(keys, imageKey(pageUrl, src))
+	}
+	res := uniqueURLs(srcs, keys)
+	if !utils.Assert(t, 2, len(res), "Invalid number of unique urls") {
+		return
+	}
+	utils.Assert(t, srcs[0], res[0], "The src should be kept as found on the page")
+	utils.Assert(t, "/b.jpg", res[1], "The src should be kept as found on the page")
+	utils.Assert(t, "invalid src%", imageKey(pageUrl, "invalid src%"), "Invalid srcs should be their own key")
+}
@@ -0,0 +1,437 @@
+package browserpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+
+	logger "propper/lib/logger"
+	sem "propper/lib/semaphore"
+)
+
+var ErrPoolClosed = errors.New("browser pool is closed")
+
+// Creates the allocator used to launch (or connect to) a browser.
+type AllocatorFactory func(ctx context.Context) (context.Context, context.CancelFunc)
+
+type pooledBrowser struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// closed once the browser is launched, or failed to launch with err
+	launched chan struct{}
+	err      error
+	uses     int
+	active   int
+	// retired browsers don't get new tabs, and are closed once their last tab is released
+	retired bool
+}
+
+func newPooledBrowser() *pooledBrowser {
+	return &pooledBrowser{launched: make(chan struct{})}
+}
+
+func (b *pooledBrowser) isLaunched() bool {
+	select {
+	case <-b.launched:
+		return b.err == nil
+	default:
+		return false
+	}
+}
+
+func (b *pooledBrowser) crashed() bool {
+	return b.isLaunched() && b.ctx.Err() != nil
+}
+
+// Waits until the browser is launched, or ctx is done.
+func (b *pooledBrowser) wait(ctx context.Context) error {
+	select {
+	case <-b.launched:
+		return b.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Set of long lived browsers shared by every job. Tabs are opened on them in
+// round robin, with a global limit of open tabs. Browsers are replaced after
+// a number of uses, or when they stop responding.
+type BrowserPool struct {
+	mu    sync.Mutex
+	slots []*pooledBrowser
+	// every browser not closed yet, including the retired ones, so they are closed with the pool
+	browsers     map[*pooledBrowser]bool
+	next         int
+	tabs         *sem.CustomSemaphore
+	maxUses      int
+	newAllocator AllocatorFactory
+	options      []chromedp.ContextOption
+	closed       bool
+	stopHealth   chan struct{}
+	// launches a browser, replaced by a fake one in the tests
+	launchBrowser func() (context.Context, context.CancelFunc, error)
+	// asks a browser for its version, replaced by a fake one in the tests
+	pingBrowser func(ctx context.Context) error
+}
+
+type Tab struct {
+	// Context of the tab, to use with chromedp.Run. It's done once the tab is released.
+	Ctx     context.Context
+	cancel  context.CancelFunc
+	browser *pooledBrowser
+	pool    *BrowserPool
+	once    sync.Once
+	// isolated browser context of the tab, only used for tabs with their own proxy
+	browserContextID cdp.BrowserContextID
+}
+
+// Browsers are launched lazily, the first time a tab is requested on their slot.
+// A healthCheckInterval of 0 disables the health checks.
+func NewBrowserPool(browsers, maxTabs, maxUses int, healthCheckInterval time.Duration, newAllocator AllocatorFactory, options ...chromedp.ContextOption) *BrowserPool {
+	if browsers < 1 {
+		browsers = 1
+	}
+	if maxTabs < 1 {
+		maxTabs = 1
+	}
+	p := &BrowserPool{
+		slots:        make([]*pooledBrowser, browsers),
+		browsers:     map[*pooledBrowser]bool{},
+		tabs:         sem.NewCustomSemaphore(maxTabs),
+		maxUses:      maxUses,
+		newAllocator: newAllocator,
+		options:      options,
+		stopHealth:   make(chan struct{}),
+	}
+	p.launchBrowser = p.launch
+	p.pingBrowser = ping
+	if healthCheckInterval > 0 {
+		go p.runHealthChecks(healthCheckInterval)
+	}
+	return p
+}
+
+func (p *BrowserPool) launch() (context.Context, context.CancelFunc, error) {
+	allocCtx, allocCancel := p.newAllocator(context.Background())
+	browserCtx, browserCancel := chromedp.NewContext(allocCtx, p.options...)
+	cancel := func() {
+		browserCancel()
+		allocCancel()
+	}
+	// running an empty action starts the browser
+	if err := chromedp.Run(browserCtx); err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	logger.Info(context.Background(), "New browser launched")
+	return browserCtx, cancel, nil
+}
+
+// Launches the browser of a placeholder slot, without holding the lock so
+// the rest of the pool isn't blocked meanwhile. Browsers that fail to
+// launch leave their slot empty, to try again with the next tab.
+func (p *BrowserPool) start(b *pooledBrowser) {
+	ctx, cancel, err := p.launchBrowser()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b.ctx, b.cancel, b.err = ctx, cancel, err
+	close(b.launched)
+	if err != nil {
+		p.removeFromSlots(b)
+		delete(p.browsers, b)
+		return
+	}
+	if p.closed || (b.retired && b.active == 0) {
+		p.closeBrowser(b)
+	}
+}
+
+// Returns the browser of the slot, starting the launch of a new one if the
+// slot is empty or its browser crashed. Must be called holding the lock.
+func (p *BrowserPool) browserOfSlot(slot int) *pooledBrowser {
+	b := p.slots[slot]
+	if b != nil && b.crashed() {
+		logger.Warn(context.Background(), "Replacing crashed browser")
+		p.retire(b)
+		b = nil
+	}
+	if b == nil {
+		b = newPooledBrowser()
+		p.slots[slot] = b
+		p.browsers[b] = true
+		go p.start(b)
+	}
+	return b
+}
+
+// Returns the browser of the next slot, which may still be launching. Must
+// be called holding the lock.
+func (p *BrowserPool) nextBrowser() *pooledBrowser {
+	slot := p.next
+	p.next = (p.next + 1) % len(p.slots)
+
+	b := p.browserOfSlot(slot)
+	b.uses += 1
+	if p.maxUses > 0 && b.uses >= p.maxUses {
+		logger.Info(context.Background(), "Recycling browser after reaching its max uses", "uses", b.uses)
+		p.slots[slot] = nil
+		b.retired = true
+	}
+	return b
+}
+
+// Must be called holding the lock.
+func (p *BrowserPool) removeFromSlots(b *pooledBrowser) {
+	for i, slot := range p.slots {
+		if slot == b {
+			p.slots[i] = nil
+		}
+	}
+}
+
+// Removes the browser from its slot, closing it if it has no open tabs.
+// Must be called holding the lock.
+func (p *BrowserPool) retire(b *pooledBrowser) {
+	p.removeFromSlots(b)
+	b.retired = true
+	if b.active == 0 && b.isLaunched() {
+		p.closeBrowser(b)
+	}
+}
+
+// Frees a tab of the browser, closing it if it's retired and it was its
+// last tab. Must be called holding the lock.
+func (p *BrowserPool) releaseBrowser(b *pooledBrowser) {
+	b.active -= 1
+	if b.retired && b.active == 0 && b.isLaunched() {
+		p.closeBrowser(b)
+	}
+}
+
+// Must be called holding the lock, once the browser is launched.
+func (p *BrowserPool) closeBrowser(b *pooledBrowser) {
+	b.cancel()
+	delete(p.browsers, b)
+}
+
+// Opens a new tab, waiting if the limit of open tabs is reached. Stops
+// waiting when ctx is done. The tab is closed when ctx is done, or when it's released.
+func (p *BrowserPool) AcquireTab(ctx context.Context) (*Tab, error) {
+	return p.AcquireTabWithProxy(ctx, "", "")
+}
+
+// Like AcquireTab, but the tab connects through proxyServer. As the proxy is
+// a setting of the whole browser, the tab is opened in its own isolated
+// browser context (no shared cookies or cache with other tabs).
+func (p *BrowserPool) AcquireTabWithProxy(ctx context.Context, proxyServer, proxyBypassList string) (*Tab, error) {
+	if err := p.tabs.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		p.releaseTabUnit()
+		return nil, ErrPoolClosed
+	}
+	b := p.nextBrowser()
+	b.active += 1
+	p.mu.Unlock()
+	err := b.wait(ctx)
+	p.mu.Lock()
+	// the pool may be closed while the browser launches
+	if err == nil && p.closed {
+		err = ErrPoolClosed
+	}
+	if err != nil {
+		p.releaseBrowser(b)
+		p.mu.Unlock()
+		p.releaseTabUnit()
+		return nil, err
+	}
+	p.mu.Unlock()
+
+	tab := &Tab{browser: b, pool: p}
+	if len(proxyServer) == 0 {
+		tab.Ctx, tab.cancel = chromedp.NewContext(b.ctx)
+	} else if err := tab.openWithProxy(proxyServer, proxyBypassList); err != nil {
+		tab.Release()
+		return nil, err
+	}
+	tabCtx := tab.Ctx
+	go func() {
+		select {
+		case <-ctx.Done():
+			tab.Release()
+		case <-tabCtx.Done():
+		}
+	}()
+	return tab, nil
+}
+
+func (t *Tab) openWithProxy(proxyServer, proxyBypassList string) error {
+	browserCtx := cdp.WithExecutor(t.browser.ctx, chromedp.FromContext(t.browser.ctx).Browser)
+	create := target.CreateBrowserContext().WithProxyServer(proxyServer)
+	if len(proxyBypassList) > 0 {
+		create = create.WithProxyBypassList(proxyBypassList)
+	}
+	id, err := create.Do(browserCtx)
+	if err != nil {
+		return err
+	}
+	t.browserContextID = id
+	targetID, err := target.CreateTarget("about:blank").WithBrowserContextID(id).Do(browserCtx)
+	if err != nil {
+		return err
+	}
+	t.Ctx, t.cancel = chromedp.NewContext(t.browser.ctx, chromedp.WithTargetID(targetID))
+	return nil
+}
+
+// Closes the tab and frees its place in the pool. Can be called more than once.
+func (t *Tab) Release() {
+	t.once.Do(func() {
+		if t.cancel != nil {
+			t.cancel()
+		}
+		if len(t.browserContextID) > 0 {
+			ctx, cancel := context.WithTimeout(t.browser.ctx, time.Second)
+			browserCtx := cdp.WithExecutor(ctx, chromedp.FromContext(t.browser.ctx).Browser)
+			if err := target.DisposeBrowserContext(t.browserContextID).Do(browserCtx); err != nil {
+				logger.Warn(context.Background(), "Couldn't dispose the browser context of a tab", "error", err)
+			}
+			cancel()
+		}
+		p := t.pool
+		p.mu.Lock()
+		p.releaseBrowser(t.browser)
+		p.mu.Unlock()
+		p.releaseTabUnit()
+	})
+}
+
+// Gives back the unit of a tab to the semaphore of the pool.
+func (p *BrowserPool) releaseTabUnit() {
+	if err := p.tabs.Release(1); err != nil {
+		logger.Error(context.Background(), "Couldn't release tab", "error", err)
+	}
+}
+
+// Number of tabs currently open.
+func (p *BrowserPool) OpenTabs() int {
+	return p.tabs.InFlight()
+}
+
+// Number of callers waiting for a tab.
+func (p *BrowserPool) WaitingTabs() int {
+	return p.tabs.Waiting()
+}
+
+func (p *BrowserPool) runHealthChecks(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stopHealth:
+			return
+		case <-ticker.C:
+			p.checkHealth(interval)
+		}
+	}
+}
+
+// Asks the browser of ctx for its version.
+func ping(ctx context.Context) error {
+	return chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		_, _, _, _, _, err := browser.GetVersion().Do(ctx)
+		return err
+	}))
+}
+
+// Asks the browser for its version, failing if it doesn't answer within timeout.
+func (p *BrowserPool) ping(b *pooledBrowser, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(b.ctx, timeout)
+	defer cancel()
+	return p.pingBrowser(ctx)
+}
+
+// Checks that a browser of the pool answers within timeout, launching it if
+// needed. Doesn't open a tab, so it isn't delayed by the limit of open tabs,
+// and doesn't count as a use of the browser.
+func (p *BrowserPool) Ping(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPoolClosed
+	}
+	var b *pooledBrowser
+	for _, slot := range p.slots {
+		if slot != nil && !slot.crashed() && (b == nil || slot.isLaunched()) {
+			b = slot
+		}
+	}
+	if b == nil {
+		b = p.browserOfSlot(p.next)
+	}
+	// so it isn't closed while it's pinged
+	b.active += 1
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.releaseBrowser(b)
+		p.mu.Unlock()
+	}()
+
+	if err := b.wait(ctx); err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	return p.ping(b, time.Until(deadline))
+}
+
+// Asks every browser for its version, retiring the ones that don't answer in time.
+func (p *BrowserPool) checkHealth(timeout time.Duration) {
+	p.mu.Lock()
+	browsers := []*pooledBrowser{}
+	for _, b := range p.slots {
+		if b != nil && b.isLaunched() {
+			browsers = append(browsers, b)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, b := range browsers {
+		if err := p.ping(b, timeout); err != nil {
+			logger.Warn(context.Background(), "Browser failed health check", "error", err)
+			p.mu.Lock()
+			p.retire(b)
+			p.mu.Unlock()
+		}
+	}
+}
+
+// Closes every browser, including the retired ones and the ones with open
+// tabs. Tabs acquired after closing the pool fail with ErrPoolClosed.
+func (p *BrowserPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.stopHealth)
+	for b := range p.browsers {
+		// browsers still launching are closed once launched
+		if b.isLaunched() {
+			p.closeBrowser(b)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package browserpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	utils "propper/test/utils"
+)
+
+// Launches fake browsers, which are only a context canceled when the browser is closed.
+type fakeAllocator struct {
+	mu       sync.Mutex
+	browsers []context.Context
+	// error of the next launches
+	err error
+	// if set, launches wait until it's closed, telling blocked when they start waiting
+	block   chan struct{}
+	blocked chan struct{}
+	// indexes of the browsers that don't answer the pings
+	unresponsive map[int]bool
+}
+
+// Index of the fake browser, in the contexts derived from it.
+type browserIndexKey struct{}
+
+func newFakePool(browsers, maxTabs, maxUses int) (*BrowserPool, *fakeAllocator) {
+	f := &fakeAllocator{unresponsive: map[int]bool{}}
+	p := NewBrowserPool(browsers, maxTabs, maxUses, 0, nil)
+	p.launchBrowser = f.launch
+	p.pingBrowser = f.ping
+	return p, f
+}
+
+func (f *fakeAllocator) launch() (context.Context, context.CancelFunc, error) {
+	f.mu.Lock()
+	block, blocked := f.block, f.blocked
+	f.mu.Unlock()
+	if block != nil {
+		blocked <- struct{}{}
+		<-block
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, nil, f.err
+	}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), browserIndexKey{}, len(f.browsers)))
+	f.browsers = append(f.browsers, ctx)
+	return ctx, cancel, nil
+}
+
+func (f *fakeAllocator) ping(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.unresponsive[ctx.Value(browserIndexKey{}).(int)] {
+		return errors.New("browser didn't answer")
+	}
+	return ctx.Err()
+}
+
+func (f *fakeAllocator) launched() []context.Context {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]context.Context{}, f.browsers...)
+}
+
+func TestRecyclesBrowsersAfterMaxUses(t *testing.T) {
+	p, f := newFakePool(1, 5, 2)
+	defer p.Close()
+
+	first, err := p.AcquireTab(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := p.AcquireTab(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(t, 1, len(f.launched()), "Both tabs should use the same browser")
+	browser := f.launched()[0]
+
+	third, err := p.AcquireTab(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(t, 2, len(f.launched()), "A new browser should replace the recycled one")
+
+	first.Release()
+	if browser.Err() != nil {
+		t.Fatal("The recycled browser shouldn't be closed while it has open tabs")
+	}
+	second.Release()
+	if browser.Err() == nil {
+		t.Error("The recycled browser should be closed with its last tab")
+	}
+	third.Release()
+	utils.Assert(t, 0, p.OpenTabs(), "Every tab should be released")
+}
+
+func TestReplacesCrashedBrowsers(t *testing.T) {
+	p, f := newFakePool(1, 5, 0)
+	defer p.Close()
+
+	tab, err := p.AcquireTab(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab.Release()
+	// the browser process exits on its own
+	p.mu.Lock()
+	p.slots[0].cancel()
+	p.mu.Unlock()
+
+	tab, err = p.AcquireTab(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tab.Release()
+	utils.Assert(t, 2, len(f.launched()), "The crashed browser should be replaced")
+}
+
+func TestHealthCheckRetiresUnresponsiveBrowsers(t *testing.T) {
+	p, f := newFakePool(2, 5, 0)
+	defer p.Close()
+
+	for i := 0; i < 2; i++ {
+		tab, err := p.AcquireTab(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		tab.Release()
+	}
+	f.mu.Lock()
+	f.unresponsive[1] = true
+	f.mu.Unlock()
+	p.checkHealth(time.Second)
+
+	browsers := f.launched()
+	if browsers[0].Err() != nil {
+		t.Error("The responsive browser should be kept")
+	}
+	if browsers[1].Err() == nil {
+		t.Error("The unresponsive browser should be closed")
+	}
+	p.mu.Lock()
+	empty := p.slots[1] == nil
+	p.mu.Unlock()
+	utils.Assert(t, true, empty, "The slot of the unresponsive browser should be freed")
+}
+
+func TestLaunchesOutsideTheLock(t *testing.T) {
+	p, f := newFakePool(2, 5, 0)
+	defer p.Close()
+
+	block, blocked := make(chan struct{}), make(chan struct{}, 1)
+	f.mu.Lock()
+	f.block, f.blocked = block, blocked
+	f.mu.Unlock()
+	launching := make(chan error, 1)
+	go func() {
+		tab, err := p.AcquireTab(context.Background())
+		if err == nil {
+			tab.Release()
+		}
+		launching <- err
+	}()
+	<-blocked
+	f.mu.Lock()
+	f.block = nil
+	f.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	tab, err := p.AcquireTab(ctx)
+	if err != nil {
+		t.Fatal("A tab on another browser shouldn't wait for the launch: ", err)
+	}
+	tab.Release()
+	close(block)
+	utils.Assert(t, nil, <-launching, "The blocked launch should finish")
+}
+
+func TestFailedLaunchesAreRetried(t *testing.T) {
+	p, f := newFakePool(1, 5, 0)
+	defer p.Close()
+
+	f.mu.Lock()
+	f.err = errors.New("no chrome")
+	f.mu.Unlock()
+	if _, err := p.AcquireTab(context.Background()); err == nil {
+		t.Fatal("Expected the launch error")
+	}
+	utils.Assert(t, 0, p.OpenTabs(), "The tab of a failed launch should be released")
+
+	f.mu.Lock()
+	f.err = nil
+	f.mu.Unlock()
+	tab, err := p.AcquireTab(context.Background())
+	if err != nil {
+		t.Fatal("The launch should be tried again: ", err)
+	}
+	tab.Release()
+}
+
+func TestPingDoesntUseBrowsers(t *testing.T) {
+	p, f := newFakePool(1, 5, 2)
+	defer p.Close()
+
+	for i := 0; i < 5; i++ {
+		utils.Assert(t, nil, p.Ping(time.Second), "The browser should answer")
+	}
+	tab, err := p.AcquireTab(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab.Release()
+	utils.Assert(t, 1, len(f.launched()), "Pings shouldn't recycle the browser")
+	if f.launched()[0].Err() != nil {
+		t.Error("Pings shouldn't close the browser")
+	}
+}
+
+func TestPingTimesOutWhileLaunching(t *testing.T) {
+	p, f := newFakePool(1, 5, 0)
+	defer p.Close()
+
+	block, blocked := make(chan struct{}), make(chan struct{}, 1)
+	f.mu.Lock()
+	f.block, f.blocked = block, blocked
+	f.mu.Unlock()
+	defer close(block)
+	start := time.Now()
+	if err := p.Ping(50 * time.Millisecond); err == nil {
+		t.Fatal("Expected a timeout while the browser launches")
+	}
+	if time.Since(start) > time.Second {
+		t.Error("The launch should be included in the timeout")
+	}
+}
+
+func TestCloseClosesEveryBrowser(t *testing.T) {
+	p, f := newFakePool(1, 5, 1)
+
+	// both browsers are retired after their first tab, which is still open
+	for i := 0; i < 2; i++ {
+		if _, err := p.AcquireTab(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	block, blocked := make(chan struct{}), make(chan struct{}, 1)
+	f.mu.Lock()
+	f.block, f.blocked = block, blocked
+	f.mu.Unlock()
+	launching := make(chan error)
+	go func() {
+		_, err := p.AcquireTab(context.Background())
+		launching <- err
+	}()
+	<-blocked
+
+	p.Close()
+	close(block)
+	utils.Assert(t, ErrPoolClosed, <-launching, "A tab waiting for the launch should fail")
+	browsers := f.launched()
+	utils.Assert(t, 3, len(browsers), "Invalid number of launched browsers")
+	for i, browser := range browsers {
+		if browser.Err() == nil {
+			t.Errorf("The browser %d should be closed", i)
+		}
+	}
+	if _, err := p.AcquireTab(context.Background()); err != ErrPoolClosed {
+		t.Error("Expected the pool to be closed, got: ", err)
+	}
+}
@@ -0,0 +1,270 @@
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var ErrNotFound = errors.New("entry not found")
+
+var (
+	// entries by url
+	entriesBucket = []byte("entries")
+	// a nested bucket per term of the titles, with the urls of the entries containing it
+	termsBucket = []byte("terms")
+)
+
+type Entry struct {
+	Url   string   `json:"url"`
+	Title string   `json:"title,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	Site  string   `json:"site"`
+	// sha256 of the saved file
+	FileHash  string    `json:"file_hash,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Conditions of the searched entries. Zero values match every entry.
+type Query struct {
+	// words of the title, the last one can be incomplete
+	Text string
+	Tag  string
+	Site string
+	// seen at some point between From and To
+	From  time.Time
+	To    time.Time
+	Limit int
+}
+
+// Index of the scraped images, in a bbolt file.
+type Catalog struct {
+	db *bolt.DB
+}
+
+// Fails after a second if another process has the file open.
+func Open(path string) (*Catalog, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{entriesBucket, termsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Catalog{db: db}, nil
+}
+
+func (c *Catalog) Close() error {
+	return c.db.Close()
+}
+
+// Lowercase words of the text, without repetitions.
+func terms(text string) []string {
+	res := []string{}
+	seen := map[string]bool{}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, word := range words {
+		if !seen[word] {
+			seen[word] = true
+			res = append(res, word)
+		}
+	}
+	return res
+}
+
+// Adds the entries seen at seenAt, or updates them if their url is already
+// indexed. The first time an entry was seen is kept, and a missing title,
+// tags or file hash don't replace the known ones.
+func (c *Catalog) Add(entries []Entry, seenAt time.Time) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		entriesB, termsB := tx.Bucket(entriesBucket), tx.Bucket(termsBucket)
+		for _, entry := range entries {
+			entry.FirstSeen, entry.LastSeen = seenAt, seenAt
+			if payload := entriesB.Get([]byte(entry.Url)); payload != nil {
+				previous := Entry{}
+				if err := json.Unmarshal(payload, &previous); err != nil {
+					return err
+				}
+				entry.FirstSeen = previous.FirstSeen
+				if previous.LastSeen.After(seenAt) {
+					entry.LastSeen = previous.LastSeen
+				}
+				if len(entry.Title) == 0 {
+					entry.Title = previous.Title
+				}
+				if len(entry.Tags) == 0 {
+					entry.Tags = previous.Tags
+				}
+				if len(entry.FileHash) == 0 {
+					entry.FileHash = previous.FileHash
+				}
+				for _, term := range terms(previous.Title) {
+					if urls := termsB.Bucket([]byte(term)); urls != nil {
+						if err := urls.Delete([]byte(entry.Url)); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			for _, term := range terms(entry.Title) {
+				urls, err := termsB.CreateBucketIfNotExists([]byte(term))
+				if err != nil {
+					return err
+				}
+				if err := urls.Put([]byte(entry.Url), []byte{}); err != nil {
+					return err
+				}
+			}
+			payload, err := json.Marshal(&entry)
+			if err != nil {
+				return err
+			}
+			if err := entriesB.Put([]byte(entry.Url), payload); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *Catalog) Get(url string) (*Entry, error) {
+	entry := &Entry{}
+	err := c.db.View(func(tx *bolt.Tx) error {
+		payload := tx.Bucket(entriesBucket).Get([]byte(url))
+		if payload == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(payload, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Urls of the entries with a title term starting with prefix.
+func urlsWithPrefix(termsB *bolt.Bucket, prefix string) map[string]bool {
+	res := map[string]bool{}
+	c := termsB.Cursor()
+	for term, _ := c.Seek([]byte(prefix)); term != nil && strings.HasPrefix(string(term), prefix); term, _ = c.Next() {
+		urls := termsB.Bucket(term)
+		if urls == nil {
+			continue
+		}
+		urls.ForEach(func(url, _ []byte) error {
+			res[string(url)] = true
+			return nil
+		})
+	}
+	return res
+}
+
+func (q *Query) match(entry *Entry) bool {
+	if len(q.Site) > 0 && entry.Site != q.Site {
+		return false
+	}
+	if !q.From.IsZero() && entry.LastSeen.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && entry.FirstSeen.After(q.To) {
+		return false
+	}
+	if len(q.Tag) > 0 {
+		for _, tag := range entry.Tags {
+			if strings.EqualFold(tag, q.Tag) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Returns the entries matching the query, the last seen first. Every word
+// of the text must be in the title, except the last one, which only needs
+// to be the beginning of a word, so results can be shown while typing.
+func (c *Catalog) Search(query Query) ([]Entry, error) {
+	res := []Entry{}
+	err := c.db.View(func(tx *bolt.Tx) error {
+		entriesB, termsB := tx.Bucket(entriesBucket), tx.Bucket(termsBucket)
+		var candidates map[string]bool
+		queryTerms := terms(query.Text)
+		for i, term := range queryTerms {
+			var urls map[string]bool
+			if i == len(queryTerms)-1 {
+				urls = urlsWithPrefix(termsB, term)
+			} else {
+				urls = map[string]bool{}
+				if b := termsB.Bucket([]byte(term)); b != nil {
+					b.ForEach(func(url, _ []byte) error {
+						urls[string(url)] = true
+						return nil
+					})
+				}
+			}
+			if candidates == nil {
+				candidates = urls
+				continue
+			}
+			for url := range candidates {
+				if !urls[url] {
+					delete(candidates, url)
+				}
+			}
+		}
+
+		check := func(payload []byte) error {
+			entry := Entry{}
+			if err := json.Unmarshal(payload, &entry); err != nil {
+				return err
+			}
+			if query.match(&entry) {
+				res = append(res, entry)
+			}
+			return nil
+		}
+		if candidates == nil {
+			return entriesB.ForEach(func(_, payload []byte) error {
+				return check(payload)
+			})
+		}
+		for url := range candidates {
+			if payload := entriesB.Get([]byte(url)); payload != nil {
+				if err := check(payload); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].LastSeen.Equal(res[j].LastSeen) {
+			return res[i].Url < res[j].Url
+		}
+		return res[i].LastSeen.After(res[j].LastSeen)
+	})
+	if query.Limit > 0 && len(res) > query.Limit {
+		res = res[:query.Limit]
+	}
+	return res, nil
+}
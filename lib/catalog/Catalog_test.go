@@ -0,0 +1,105 @@
+package catalog_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	catalog "propper/lib/catalog"
+)
+
+func openCatalog(t *testing.T) *catalog.Catalog {
+	c, err := catalog.Open(filepath.Join(t.TempDir(), "catalog.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func urlsOf(entries []catalog.Entry) []string {
+	res := []string{}
+	for _, entry := range entries {
+		res = append(res, entry.Url)
+	}
+	return res
+}
+
+func TestSearch(t *testing.T) {
+	c := openCatalog(t)
+	monday := time.Date(2022, 1, 3, 0, 0, 0, 0, time.UTC)
+	tuesday := monday.Add(24 * time.Hour)
+	c.Add([]catalog.Entry{
+		{Url: "http://a.com/1.jpg", Title: "Grumpy cat hates Mondays", Tags: []string{"cats"}, Site: "http://a.com"},
+		{Url: "http://a.com/2.jpg", Title: "Doge, much wow", Tags: []string{"dogs"}, Site: "http://a.com"},
+	}, monday)
+	c.Add([]catalog.Entry{
+		{Url: "http://b.com/1.jpg", Title: "Cat in a box", Tags: []string{"Cats"}, Site: "http://b.com"},
+	}, tuesday)
+
+	cases := []struct {
+		query    catalog.Query
+		expected string
+	}{
+		{catalog.Query{Text: "cat"}, "[http://b.com/1.jpg http://a.com/1.jpg]"},
+		{catalog.Query{Text: "GRUMPY cat"}, "[http://a.com/1.jpg]"},
+		{catalog.Query{Text: "mon"}, "[http://a.com/1.jpg]"},
+		{catalog.Query{Text: "wow much"}, "[http://a.com/2.jpg]"},
+		{catalog.Query{Text: "dog"}, "[http://a.com/2.jpg]"},
+		{catalog.Query{Text: "cat box", Site: "http://a.com"}, "[]"},
+		{catalog.Query{Tag: "cats"}, "[http://b.com/1.jpg http://a.com/1.jpg]"},
+		{catalog.Query{From: tuesday}, "[http://b.com/1.jpg]"},
+		{catalog.Query{To: monday}, "[http://a.com/1.jpg http://a.com/2.jpg]"},
+		{catalog.Query{Limit: 1}, "[http://b.com/1.jpg]"},
+	}
+	for _, tc := range cases {
+		entries, err := c.Search(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(urlsOf(entries)); got != tc.expected {
+			t.Errorf("Search %+v: expected %s, got %s", tc.query, tc.expected, got)
+		}
+	}
+}
+
+func TestAddKeepsFirstSeenAndReindexesTitle(t *testing.T) {
+	c := openCatalog(t)
+	monday := time.Date(2022, 1, 3, 0, 0, 0, 0, time.UTC)
+	c.Add([]catalog.Entry{{Url: "http://a.com/1.jpg", Title: "Old title", FileHash: "abc"}}, monday)
+	c.Add([]catalog.Entry{{Url: "http://a.com/1.jpg", Title: "New title"}}, monday.Add(time.Hour))
+
+	entries, _ := c.Search(catalog.Query{Text: "old"})
+	if len(entries) != 0 {
+		t.Error("The previous title should be removed from the index")
+	}
+	entries, _ = c.Search(catalog.Query{Text: "new"})
+	if len(entries) != 1 {
+		t.Fatal("Expected the entry by its new title")
+	}
+	entry := entries[0]
+	if !entry.FirstSeen.Equal(monday) || !entry.LastSeen.Equal(monday.Add(time.Hour)) {
+		t.Error("Unexpected seen times: ", entry.FirstSeen, entry.LastSeen)
+	}
+	if entry.FileHash != "abc" {
+		t.Error("The known file hash should be kept, got: ", entry.FileHash)
+	}
+}
+
+func TestGet(t *testing.T) {
+	c := openCatalog(t)
+	monday := time.Date(2022, 1, 3, 0, 0, 0, 0, time.UTC)
+	c.Add([]catalog.Entry{{Url: "http://a.com/1.jpg", Title: "Grumpy cat"}}, monday)
+
+	entry, err := c.Get("http://a.com/1.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Title != "Grumpy cat" || !entry.FirstSeen.Equal(monday) {
+		t.Error("Unexpected entry: ", entry)
+	}
+	if _, err := c.Get("http://a.com/2.jpg"); err != catalog.ErrNotFound {
+		t.Error("Expected not found, got: ", err)
+	}
+}
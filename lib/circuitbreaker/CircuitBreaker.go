@@ -0,0 +1,116 @@
+package circuitbreaker
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// States of a breaker
+const (
+	Closed   = "closed"
+	Open     = "open"
+	HalfOpen = "half-open"
+)
+
+// Stops calls to a failing dependency. The breaker opens after maxFailures
+// consecutive failures, rejecting every call for openTime. Then it lets
+// halfOpenTrials calls through: it closes again if one of them succeeds, and
+// opens again if one fails.
+type Breaker struct {
+	mu             sync.Mutex
+	state          string
+	failures       int
+	openedAt       time.Time
+	trials         int
+	maxFailures    int
+	openTime       time.Duration
+	halfOpenTrials int
+}
+
+// State of a breaker, as reported by the status endpoint.
+type Status struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	// seconds until the next trial is allowed, while open
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+func NewBreaker(maxFailures int, openTime time.Duration, halfOpenTrials int) *Breaker {
+	if maxFailures < 1 {
+		maxFailures = 1
+	}
+	if halfOpenTrials < 1 {
+		halfOpenTrials = 1
+	}
+	return &Breaker{state: Closed, maxFailures: maxFailures, openTime: openTime, halfOpenTrials: halfOpenTrials}
+}
+
+// Returns whether the call can go on. Otherwise it returns the time until
+// the breaker lets calls through again. Every allowed call must be followed
+// by one of ReportSuccess, ReportFailure or Release.
+func (b *Breaker) Allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open {
+		remaining := b.openTime - time.Since(b.openedAt)
+		if remaining > 0 {
+			return false, remaining
+		}
+		b.state = HalfOpen
+		b.trials = 0
+	}
+	if b.state == HalfOpen {
+		if b.trials >= b.halfOpenTrials {
+			// the trials are still running, try again soon
+			return false, time.Second
+		}
+		b.trials += 1
+	}
+	return true, 0
+}
+
+func (b *Breaker) ReportSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.state = Closed
+	b.trials = 0
+}
+
+func (b *Breaker) ReportFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures += 1
+	if b.state == HalfOpen || b.failures >= b.maxFailures {
+		b.state = Open
+		b.openedAt = time.Now()
+		b.trials = 0
+	}
+}
+
+// Ends an allowed call whose result says nothing about the dependency.
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == HalfOpen && b.trials > 0 {
+		b.trials -= 1
+	}
+}
+
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := Status{State: b.state, ConsecutiveFailures: b.failures}
+	if b.state != Closed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	if b.state == Open {
+		if remaining := b.openTime - time.Since(b.openedAt); remaining > 0 {
+			status.RetryAfter = int(math.Ceil(remaining.Seconds()))
+		}
+	}
+	return status
+}
@@ -0,0 +1,63 @@
+package circuitbreaker_test
+
+import (
+	"testing"
+	"time"
+
+	circuitbreaker "propper/lib/circuitbreaker"
+)
+
+func TestOpensAfterConsecutiveFailures(t *testing.T) {
+	breaker := circuitbreaker.NewBreaker(2, time.Minute, 1)
+	breaker.Allow()
+	breaker.ReportFailure()
+	breaker.Allow()
+	breaker.ReportSuccess()
+	breaker.Allow()
+	breaker.ReportFailure()
+	if ok, _ := breaker.Allow(); !ok {
+		t.Fatal("Breaker opened without consecutive failures")
+	}
+	breaker.ReportFailure()
+
+	ok, retryAfter := breaker.Allow()
+	if ok {
+		t.Fatal("Expected the breaker to be open")
+	}
+	if retryAfter <= 0 || retryAfter > time.Minute {
+		t.Error("Unexpected retry after: ", retryAfter)
+	}
+	status := breaker.Status()
+	if status.State != circuitbreaker.Open || status.ConsecutiveFailures != 2 || status.RetryAfter != 60 {
+		t.Error("Unexpected status: ", status)
+	}
+}
+
+func TestHalfOpenTrials(t *testing.T) {
+	breaker := circuitbreaker.NewBreaker(1, 20*time.Millisecond, 1)
+	breaker.Allow()
+	breaker.ReportFailure()
+	time.Sleep(30 * time.Millisecond)
+
+	if ok, _ := breaker.Allow(); !ok {
+		t.Fatal("Expected a trial after the open time")
+	}
+	if ok, _ := breaker.Allow(); ok {
+		t.Fatal("Expected a single trial while half open")
+	}
+	breaker.ReportFailure()
+	if ok, _ := breaker.Allow(); ok {
+		t.Fatal("Expected the breaker to open again after a failed trial")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	breaker.Allow()
+	breaker.Release()
+	if ok, _ := breaker.Allow(); !ok {
+		t.Fatal("Expected a new trial after releasing the previous one")
+	}
+	breaker.ReportSuccess()
+	if status := breaker.Status(); status.State != circuitbreaker.Closed || status.ConsecutiveFailures != 0 {
+		t.Error("Expected the breaker to close after a successful trial: ", status)
+	}
+}
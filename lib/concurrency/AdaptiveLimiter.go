@@ -0,0 +1,182 @@
+package concurrency
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	logger "propper/lib/logger"
+	sem "propper/lib/semaphore"
+)
+
+// Concurrency chosen along a job, as reported in its results.
+type Stats struct {
+	Initial int `json:"initial"`
+	Final   int `json:"final"`
+	Peak    int `json:"peak"`
+}
+
+// Limits the calls running at once with AIMD: the limit grows by one unit
+// per round of calls that succeed quickly, and is multiplied by backoff
+// after an error or when the latency grows beyond latencyTolerance times
+// the lowest latency seen. It always stays between min and max. The calls
+// running when the limit goes down started under the previous limit, so
+// their errors and slow responses don't decrease it again.
+type AdaptiveLimiter struct {
+	mu               sync.Mutex
+	sem              *sem.CustomSemaphore
+	min              int
+	max              int
+	limit            float64
+	backoff          float64
+	latencyTolerance float64
+	minLatency       time.Duration
+	// units of the semaphore held back to keep the calls under the limit
+	parked int
+	// reports left from the calls running at the last decrease
+	window  int
+	initial int
+	peak    int
+}
+
+func NewAdaptiveLimiter(min, max, initial int, backoff, latencyTolerance float64) *AdaptiveLimiter {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	if initial < min {
+		initial = min
+	}
+	if initial > max {
+		initial = max
+	}
+	l := &AdaptiveLimiter{
+		sem:              sem.NewCustomSemaphore(max),
+		min:              min,
+		max:              max,
+		limit:            float64(initial),
+		backoff:          backoff,
+		latencyTolerance: latencyTolerance,
+		initial:          initial,
+		peak:             initial,
+	}
+	l.resize()
+	return l
+}
+
+// Waits until the number of calls running is under the limit, or ctx is done.
+func (l *AdaptiveLimiter) Acquire(ctx context.Context) error {
+	return l.sem.Acquire(ctx, 1)
+}
+
+// Ends a call. Must be called once for every successful Acquire.
+func (l *AdaptiveLimiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// the limit went down while the call was running, its unit is held back
+	if l.parked < l.max-l.currentLimit() {
+		l.parked += 1
+		return
+	}
+	l.release(1)
+}
+
+func (l *AdaptiveLimiter) ReportSuccess(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.minLatency == 0 || latency < l.minLatency {
+		l.minLatency = latency
+	}
+	inWindow := l.inDecreaseWindow()
+	if float64(latency) > float64(l.minLatency)*l.latencyTolerance {
+		if !inWindow {
+			l.decrease()
+		}
+		return
+	}
+	l.limit = math.Min(l.limit+1/l.limit, float64(l.max))
+	l.resize()
+}
+
+// Reports an error or a throttled call.
+func (l *AdaptiveLimiter) ReportFailure() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.inDecreaseWindow() {
+		l.decrease()
+	}
+}
+
+// Counts a report, returning true if it comes from the calls running at the
+// last decrease. Must be called holding the lock.
+func (l *AdaptiveLimiter) inDecreaseWindow() bool {
+	if l.window == 0 {
+		return false
+	}
+	l.window -= 1
+	return true
+}
+
+// Must be called holding the lock, by the call being reported.
+func (l *AdaptiveLimiter) decrease() {
+	running := l.sem.InFlight() - l.parked
+	l.limit = math.Max(l.limit*l.backoff, float64(l.min))
+	l.resize()
+	// the other calls running when the limit went down
+	if running > 1 {
+		l.window = running - 1
+	}
+}
+
+// Holds back or returns units of the semaphore to match the limit. Units
+// that are in use when the limit goes down are held back on their release.
+// Must be called holding the lock.
+func (l *AdaptiveLimiter) resize() {
+	limit := l.currentLimit()
+	if limit > l.peak {
+		l.peak = limit
+	}
+	target := l.max - limit
+	if l.parked > target {
+		l.release(l.parked - target)
+		l.parked = target
+		return
+	}
+	for l.parked < target && l.sem.TryAcquire(1) {
+		l.parked += 1
+	}
+}
+
+func (l *AdaptiveLimiter) release(n int) {
+	if err := l.sem.Release(n); err != nil {
+		logger.Error(context.Background(), "Couldn't release limiter units", "units", n, "error", err)
+	}
+}
+
+// Calls allowed to run at once.
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.currentLimit()
+}
+
+// Must be called holding the lock.
+func (l *AdaptiveLimiter) currentLimit() int {
+	return int(l.limit)
+}
+
+// Calls running.
+func (l *AdaptiveLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sem.InFlight() - l.parked
+}
+
+func (l *AdaptiveLimiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Stats{Initial: l.initial, Final: l.currentLimit(), Peak: l.peak}
+}
@@ -0,0 +1,88 @@
+package concurrency_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	concurrency "propper/lib/concurrency"
+)
+
+func TestGrowsOnFastSuccesses(t *testing.T) {
+	limiter := concurrency.NewAdaptiveLimiter(1, 4, 1, 0.5, 2)
+	for i := 0; i < 10; i += 1 {
+		limiter.ReportSuccess(10 * time.Millisecond)
+	}
+	if limiter.Limit() != 4 {
+		t.Error("Expected the limit to grow up to the max, got: ", limiter.Limit())
+	}
+	stats := limiter.Stats()
+	if stats.Initial != 1 || stats.Final != 4 || stats.Peak != 4 {
+		t.Error("Unexpected stats: ", stats)
+	}
+}
+
+func TestBacksOffOnFailuresAndLatency(t *testing.T) {
+	limiter := concurrency.NewAdaptiveLimiter(1, 8, 8, 0.5, 2)
+	limiter.ReportFailure()
+	if limiter.Limit() != 4 {
+		t.Error("Expected the limit to halve after a failure, got: ", limiter.Limit())
+	}
+	limiter.ReportSuccess(10 * time.Millisecond)
+	limiter.ReportSuccess(50 * time.Millisecond)
+	if limiter.Limit() != 2 {
+		t.Error("Expected the limit to halve after a slow call, got: ", limiter.Limit())
+	}
+	for i := 0; i < 5; i += 1 {
+		limiter.ReportFailure()
+	}
+	if limiter.Limit() != 1 {
+		t.Error("Expected the limit to stop at the min, got: ", limiter.Limit())
+	}
+}
+
+func TestDecreasesOncePerWindow(t *testing.T) {
+	limiter := concurrency.NewAdaptiveLimiter(1, 8, 8, 0.5, 2)
+	for i := 0; i < 4; i += 1 {
+		limiter.Acquire(context.Background())
+	}
+	limiter.ReportSuccess(10 * time.Millisecond)
+	// the 4 running calls are throttled together
+	for i := 0; i < 4; i += 1 {
+		limiter.ReportFailure()
+	}
+	if limiter.Limit() != 4 {
+		t.Error("Expected a single decrease for the calls running together, got: ", limiter.Limit())
+	}
+	limiter.ReportSuccess(50 * time.Millisecond)
+	if limiter.Limit() != 2 {
+		t.Error("Expected a new decrease once the window is over, got: ", limiter.Limit())
+	}
+}
+
+func TestAcquireFollowsTheLimit(t *testing.T) {
+	limiter := concurrency.NewAdaptiveLimiter(1, 4, 2, 0.5, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	limiter.Acquire(ctx)
+	limiter.Acquire(ctx)
+	if err := limiter.Acquire(ctx); err == nil {
+		t.Fatal("Acquired over the limit")
+	}
+
+	// the limit goes down while both calls run, so releasing one doesn't free a place
+	limiter.ReportFailure()
+	limiter.Release()
+	if limiter.InFlight() != 1 {
+		t.Error("Unexpected calls in flight: ", limiter.InFlight())
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := limiter.Acquire(ctx); err == nil {
+		t.Fatal("Acquired over the reduced limit")
+	}
+	limiter.Release()
+	if err := limiter.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
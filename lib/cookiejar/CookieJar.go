@@ -0,0 +1,145 @@
+package cookiejar
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Cookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Domain   string `json:"domain"`
+	Path     string `json:"path"`
+	Secure   bool   `json:"secure"`
+	HttpOnly bool   `json:"http_only"`
+	// zero for session cookies
+	Expires time.Time `json:"expires"`
+}
+
+func (c Cookie) key() string {
+	return c.Domain + "|" + c.Path + "|" + c.Name
+}
+
+func (c Cookie) expired(now time.Time) bool {
+	return !c.Expires.IsZero() && c.Expires.Before(now)
+}
+
+// Parses a cookies.txt file in the Netscape format used by curl and browser
+// extensions: one cookie per line with the fields domain, include subdomains,
+// path, secure, expiration, name and value separated by tabs.
+func ParseNetscape(r io.Reader) ([]Cookie, error) {
+	cookies := []Cookie{}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber += 1
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := false
+		if strings.HasPrefix(line, "#HttpOnly_") {
+			httpOnly = true
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+		}
+		if len(strings.TrimSpace(line)) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("invalid cookie on line %d: expected 7 fields, got %d", lineNumber, len(fields))
+		}
+		expires := time.Time{}
+		seconds, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cookie expiration on line %d: %w", lineNumber, err)
+		}
+		if seconds > 0 {
+			expires = time.Unix(seconds, 0).UTC()
+		}
+		cookies = append(cookies, Cookie{
+			Domain:   fields[0],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Expires:  expires,
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		})
+	}
+	return cookies, scanner.Err()
+}
+
+// Cookies of a site, saved as json in a file so they survive restarts.
+type Jar struct {
+	mu      sync.Mutex
+	path    string
+	cookies map[string]Cookie
+}
+
+// Loads the jar saved in path. A missing file gives an empty jar, and an
+// empty path gives a jar that is only kept in memory.
+func Load(path string) (*Jar, error) {
+	jar := &Jar{path: path, cookies: map[string]Cookie{}}
+	if len(path) == 0 {
+		return jar, nil
+	}
+	payload, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return jar, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cookies := []Cookie{}
+	if err := json.Unmarshal(payload, &cookies); err != nil {
+		return nil, fmt.Errorf("invalid cookie jar '%s': %w", path, err)
+	}
+	jar.Merge(cookies)
+	return jar, nil
+}
+
+// Adds the cookies, replacing the ones with the same domain, path and name.
+func (j *Jar) Merge(cookies []Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, cookie := range cookies {
+		j.cookies[cookie.key()] = cookie
+	}
+}
+
+// Cookies that haven't expired.
+func (j *Jar) Cookies() []Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	res := []Cookie{}
+	for key, cookie := range j.cookies {
+		if cookie.expired(now) {
+			delete(j.cookies, key)
+			continue
+		}
+		res = append(res, cookie)
+	}
+	return res
+}
+
+// Writes the jar to its file. Does nothing for jars kept in memory.
+func (j *Jar) Save() error {
+	if len(j.path) == 0 {
+		return nil
+	}
+	payload, err := json.MarshalIndent(j.Cookies(), "", "  ")
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	// cookies can hold sessions, only the owner can read them
+	return ioutil.WriteFile(j.path, payload, 0600)
+}
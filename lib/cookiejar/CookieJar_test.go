@@ -0,0 +1,68 @@
+package cookiejar_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cookiejar "propper/lib/cookiejar"
+)
+
+const cookiesTxt = "# Netscape HTTP Cookie File\n" +
+	"\n" +
+	".example.com\tTRUE\t/\tFALSE\t0\tconsent\tyes\n" +
+	"#HttpOnly_example.com\tFALSE\t/account\tTRUE\t4102444800\tsession\tabc=123\n"
+
+func TestParseNetscape(t *testing.T) {
+	cookies, err := cookiejar.ParseNetscape(strings.NewReader(cookiesTxt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cookies) != 2 {
+		t.Fatalf("Expected 2 cookies, got %d", len(cookies))
+	}
+	consent := cookies[0]
+	if consent.Domain != ".example.com" || consent.Name != "consent" || consent.Value != "yes" || !consent.Expires.IsZero() || consent.HttpOnly {
+		t.Error("Unexpected session cookie: ", consent)
+	}
+	session := cookies[1]
+	if session.Domain != "example.com" || session.Path != "/account" || session.Value != "abc=123" || !session.Secure || !session.HttpOnly {
+		t.Error("Unexpected http only cookie: ", session)
+	}
+	if !session.Expires.Equal(time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("Unexpected expiration: ", session.Expires)
+	}
+}
+
+func TestParseNetscapeInvalidLine(t *testing.T) {
+	_, err := cookiejar.ParseNetscape(strings.NewReader("example.com\tFALSE\t/\n"))
+	if err == nil {
+		t.Error("Expected an error for a line with missing fields")
+	}
+}
+
+func TestJarPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "example.com.json")
+	jar, err := cookiejar.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jar.Merge([]cookiejar.Cookie{
+		{Name: "a", Value: "1", Domain: "example.com", Path: "/"},
+		{Name: "expired", Value: "1", Domain: "example.com", Path: "/", Expires: time.Now().Add(-time.Hour)},
+	})
+	jar.Merge([]cookiejar.Cookie{{Name: "a", Value: "2", Domain: "example.com", Path: "/"}})
+	if err := jar.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := cookiejar.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := loaded.Cookies()
+	if len(cookies) != 1 || cookies[0].Value != "2" {
+		t.Error("Unexpected cookies after reloading the jar: ", cookies)
+	}
+}
@@ -0,0 +1,196 @@
+package imagehash
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+)
+
+// 64 bits perceptual hash of an image. Similar images have hashes with a small
+// hamming distance between them.
+type Hash uint64
+
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+func (h *Hash) UnmarshalText(text []byte) error {
+	parsed, err := ParseHash(string(text))
+	if err != nil {
+		return err
+	}
+	*h = parsed
+	return nil
+}
+
+func ParseHash(s string) (Hash, error) {
+	val, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hash '%s': %w", s, err)
+	}
+	return Hash(val), nil
+}
+
+// Number of different bits between both hashes.
+func Distance(a, b Hash) int {
+	return bits.OnesCount64(uint64(a) ^ uint64(b))
+}
+
+type Hashes struct {
+	AHash Hash `json:"ahash"`
+	DHash Hash `json:"dhash"`
+	PHash Hash `json:"phash"`
+}
+
+// Decodes the image (jpeg, png or gif) and computes all its hashes.
+func FromBytes(buf []byte) (*Hashes, error) {
+	img, _, err := image.Decode(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	return &Hashes{
+		AHash: AverageHash(img),
+		DHash: DifferenceHash(img),
+		PHash: PerceptionHash(img),
+	}, nil
+}
+
+// Each bit tells if the pixel of the 8x8 grayscale image is brighter than the mean.
+func AverageHash(img image.Image) Hash {
+	pixels := grayscale(img, 8, 8)
+	mean := 0.0
+	for _, p := range pixels {
+		mean += p
+	}
+	mean /= float64(len(pixels))
+
+	var hash Hash
+	for i, p := range pixels {
+		if p > mean {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// Each bit tells if a pixel of the 9x8 grayscale image is brighter than its right neighbour.
+func DifferenceHash(img image.Image) Hash {
+	pixels := grayscale(img, 9, 8)
+	var hash Hash
+	bit := 0
+	for y := 0; y < 8; y += 1 {
+		for x := 0; x < 8; x += 1 {
+			if pixels[y*9+x] > pixels[y*9+x+1] {
+				hash |= 1 << uint(bit)
+			}
+			bit += 1
+		}
+	}
+	return hash
+}
+
+// Each bit tells if the coefficient of the 8x8 lowest frequencies of the DCT
+// of the 32x32 grayscale image is greater than their median.
+func PerceptionHash(img image.Image) Hash {
+	const size = 32
+	pixels := grayscale(img, size, size)
+	coefficients := dct2D(pixels, size)
+
+	lowFrequencies := make([]float64, 0, 64)
+	for y := 0; y < 8; y += 1 {
+		for x := 0; x < 8; x += 1 {
+			lowFrequencies = append(lowFrequencies, coefficients[y*size+x])
+		}
+	}
+	// the first coefficient is the average of the image, it's excluded from the median
+	sorted := append([]float64{}, lowFrequencies[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var hash Hash
+	for i, c := range lowFrequencies {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// Scales the image to width x height using the mean of the pixels of each
+// area, and returns the luminance of the resulting pixels by rows.
+func grayscale(img image.Image, width, height int) []float64 {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	res := make([]float64, width*height)
+	if srcWidth == 0 || srcHeight == 0 {
+		return res
+	}
+	for y := 0; y < height; y += 1 {
+		y0, y1 := areaLimits(y, height, srcHeight)
+		for x := 0; x < width; x += 1 {
+			x0, x1 := areaLimits(x, width, srcWidth)
+			sum, count := 0.0, 0
+			for sy := y0; sy < y1; sy += 1 {
+				for sx := x0; sx < x1; sx += 1 {
+					r, g, b, _ := img.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+					count += 1
+				}
+			}
+			res[y*width+x] = sum / float64(count)
+		}
+	}
+	return res
+}
+
+// Range of source pixels covered by the i-th of n destination pixels.
+func areaLimits(i, n, srcSize int) (int, int) {
+	from := i * srcSize / n
+	to := (i + 1) * srcSize / n
+	if to <= from {
+		to = from + 1
+	}
+	return from, to
+}
+
+// Type II discrete cosine transform of a size x size matrix.
+func dct2D(pixels []float64, size int) []float64 {
+	cosines := make([]float64, size*size)
+	for k := 0; k < size; k += 1 {
+		for n := 0; n < size; n += 1 {
+			cosines[k*size+n] = math.Cos(math.Pi / float64(size) * (float64(n) + 0.5) * float64(k))
+		}
+	}
+	rows := make([]float64, size*size)
+	for y := 0; y < size; y += 1 {
+		for k := 0; k < size; k += 1 {
+			sum := 0.0
+			for n := 0; n < size; n += 1 {
+				sum += pixels[y*size+n] * cosines[k*size+n]
+			}
+			rows[y*size+k] = sum
+		}
+	}
+	res := make([]float64, size*size)
+	for x := 0; x < size; x += 1 {
+		for k := 0; k < size; k += 1 {
+			sum := 0.0
+			for n := 0; n < size; n += 1 {
+				sum += rows[n*size+x] * cosines[k*size+n]
+			}
+			res[k*size+x] = sum
+		}
+	}
+	return res
+}
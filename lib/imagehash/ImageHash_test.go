@@ -0,0 +1,93 @@
+package imagehash_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"testing"
+
+	imagehash "propper/lib/imagehash"
+	utils "propper/test/utils"
+)
+
+var testImagePath = "../../test/data/test_image.jpg"
+
+// Re-encodes the image at half its size, as a repost of the same meme would be.
+func halfSizeCopy(t *testing.T, img image.Image) []byte {
+	bounds := img.Bounds()
+	small := image.NewRGBA(image.Rect(0, 0, bounds.Dx()/2, bounds.Dy()/2))
+	for y := 0; y < bounds.Dy()/2; y += 1 {
+		for x := 0; x < bounds.Dx()/2; x += 1 {
+			small.Set(x, y, img.At(bounds.Min.X+x*2, bounds.Min.Y+y*2))
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, small, &jpeg.Options{Quality: 60}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestResizedImageIsNearDuplicate(t *testing.T) {
+	buf, err := ioutil.ReadFile(testImagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, err := imagehash.FromBytes(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resized, err := imagehash.FromBytes(halfSizeCopy(t, img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := imagehash.Distance(original.AHash, resized.AHash); d > 10 {
+		t.Error("aHash distance too big: ", d)
+	}
+	if d := imagehash.Distance(original.DHash, resized.DHash); d > 10 {
+		t.Error("dHash distance too big: ", d)
+	}
+	if d := imagehash.Distance(original.PHash, resized.PHash); d > 10 {
+		t.Error("pHash distance too big: ", d)
+	}
+}
+
+func TestDifferentImagesAreFarApart(t *testing.T) {
+	buf, err := ioutil.ReadFile(testImagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// checkerboard pattern, unrelated to the test image
+	bounds := img.Bounds()
+	other := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += 1 {
+		for x := bounds.Min.X; x < bounds.Max.X; x += 1 {
+			if (x/16+y/16)%2 == 0 {
+				other.Set(x, y, color.White)
+			}
+		}
+	}
+	if d := imagehash.Distance(imagehash.PerceptionHash(img), imagehash.PerceptionHash(other)); d <= 10 {
+		t.Error("pHash distance too small for different images: ", d)
+	}
+}
+
+func TestHashTextRoundTrip(t *testing.T) {
+	hash := imagehash.Hash(0xf0f0a5a5000000ff)
+	parsed, err := imagehash.ParseHash(hash.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(t, hash, parsed, "Invalid parsed hash")
+	utils.Assert(t, 2, imagehash.Distance(0x3, 0x0), "Invalid distance")
+}
@@ -0,0 +1,209 @@
+package jobstore
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	imagehash "propper/lib/imagehash"
+)
+
+var ErrNotFound = errors.New("job not found")
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+var (
+	// records by start time and id, so they are listed in order
+	jobsBucket = []byte("jobs")
+	// key in jobsBucket of each id
+	idsBucket = []byte("ids")
+)
+
+type Image struct {
+	Url         string            `json:"url"`
+	File        string            `json:"file,omitempty"`
+	Hashes      *imagehash.Hashes `json:"hashes,omitempty"`
+	DuplicateOf string            `json:"duplicate_of,omitempty"`
+	Proxy       string            `json:"proxy,omitempty"`
+}
+
+// Threads used to query the pages of a job.
+type Concurrency struct {
+	Initial int `json:"initial"`
+	Final   int `json:"final"`
+	Peak    int `json:"peak"`
+}
+
+type Record struct {
+	ID         string     `json:"id"`
+	Site       string     `json:"site"`
+	Status     string     `json:"status"`
+	Amount     int        `json:"amount"`
+	Threads    int        `json:"threads"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// times the job was resumed after being interrupted
+	Resumes   int     `json:"resumes,omitempty"`
+	Directory string  `json:"directory,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	ErrorType string  `json:"error_type,omitempty"`
+	Images    []Image `json:"images,omitempty"`
+	// missing until the pages are queried
+	Concurrency *Concurrency `json:"concurrency,omitempty"`
+}
+
+// Conditions of the listed records. Zero values match every record.
+type Filter struct {
+	Status string
+	Site   string
+	// started at or after it
+	Since time.Time
+	// fetched the image with the url
+	ImageUrl string
+}
+
+func (f *Filter) match(record *Record) bool {
+	if len(f.Status) > 0 && record.Status != f.Status {
+		return false
+	}
+	if len(f.Site) > 0 && record.Site != f.Site {
+		return false
+	}
+	if len(f.ImageUrl) > 0 {
+		for _, image := range record.Images {
+			if image.Url == f.ImageUrl {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// History of the jobs, in a bbolt file.
+type Store struct {
+	db *bolt.DB
+}
+
+// Fails after a second if another process has the file open.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{jobsBucket, idsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Big endian nanoseconds followed by the id, so keys sort by start time.
+func keyOf(record *Record) []byte {
+	key := make([]byte, 8, 8+len(record.ID))
+	binary.BigEndian.PutUint64(key, uint64(record.StartedAt.UnixNano()))
+	return append(key, record.ID...)
+}
+
+// Saves the record, replacing the one with the same id.
+func (s *Store) Put(record *Record) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		jobs, ids := tx.Bucket(jobsBucket), tx.Bucket(idsBucket)
+		key := keyOf(record)
+		// the start time of a job doesn't change, but its previous key is removed just in case
+		if previous := ids.Get([]byte(record.ID)); previous != nil && string(previous) != string(key) {
+			if err := jobs.Delete(previous); err != nil {
+				return err
+			}
+		}
+		if err := ids.Put([]byte(record.ID), key); err != nil {
+			return err
+		}
+		return jobs.Put(key, payload)
+	})
+}
+
+func (s *Store) Get(id string) (*Record, error) {
+	record := &Record{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		key := tx.Bucket(idsBucket).Get([]byte(id))
+		if key == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(tx.Bucket(jobsBucket).Get(key), record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Returns up to limit records matching the filter, the newest first. The
+// returned cursor, empty on the last page, continues the list when passed
+// to the next call.
+func (s *Store) List(filter Filter, limit int, cursor string) ([]Record, string, error) {
+	var after []byte
+	if len(cursor) > 0 {
+		var err error
+		if after, err = hex.DecodeString(cursor); err != nil || len(after) < 8 {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+	res := []Record{}
+	next := ""
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(jobsBucket).Cursor()
+		var key, value []byte
+		if after == nil {
+			key, value = c.Last()
+		} else {
+			// the cursor is the key of the last record returned
+			if key, _ = c.Seek(after); key == nil {
+				key, value = c.Last()
+			} else {
+				key, value = c.Prev()
+			}
+		}
+		for ; key != nil; key, value = c.Prev() {
+			if !filter.Since.IsZero() && int64(binary.BigEndian.Uint64(key[:8])) < filter.Since.UnixNano() {
+				break
+			}
+			record := Record{}
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			if !filter.match(&record) {
+				continue
+			}
+			if len(res) == limit {
+				next = hex.EncodeToString(keyOf(&res[len(res)-1]))
+				break
+			}
+			res = append(res, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return res, next, nil
+}
@@ -0,0 +1,103 @@
+package jobstore_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jobstore "propper/lib/jobstore"
+)
+
+func openStore(t *testing.T) *jobstore.Store {
+	store, err := jobstore.Open(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestPutAndGet(t *testing.T) {
+	store := openStore(t)
+	record := &jobstore.Record{ID: "a", Site: "http://example.com", Status: "running", StartedAt: time.Now().UTC()}
+	if err := store.Put(record); err != nil {
+		t.Fatal(err)
+	}
+	record.Status = "finished"
+	record.Images = []jobstore.Image{{Url: "http://example.com/1.jpg", File: "1.jpg"}}
+	if err := store.Put(record); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := store.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Status != "finished" || len(loaded.Images) != 1 {
+		t.Error("Unexpected record: ", loaded)
+	}
+	if _, err := store.Get("missing"); err != jobstore.ErrNotFound {
+		t.Error("Expected not found, got: ", err)
+	}
+	records, _, err := store.List(jobstore.Filter{}, 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Error("Updating a record shouldn't duplicate it, got: ", len(records))
+	}
+}
+
+func TestListFiltersAndPages(t *testing.T) {
+	store := openStore(t)
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i += 1 {
+		status := "finished"
+		if i%2 == 1 {
+			status = "failed"
+		}
+		store.Put(&jobstore.Record{
+			ID:        fmt.Sprintf("job%d", i),
+			Site:      "http://example.com",
+			Status:    status,
+			StartedAt: start.Add(time.Duration(i) * time.Hour),
+			Images:    []jobstore.Image{{Url: fmt.Sprintf("http://example.com/%d.jpg", i%3)}},
+		})
+	}
+
+	ids := []string{}
+	cursor := ""
+	for {
+		records, next, err := store.List(jobstore.Filter{Status: "finished"}, 2, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, record := range records {
+			ids = append(ids, record.ID)
+		}
+		if len(next) == 0 {
+			break
+		}
+		cursor = next
+	}
+	if fmt.Sprint(ids) != "[job8 job6 job4 job2 job0]" {
+		t.Error("Unexpected finished jobs, newest first: ", ids)
+	}
+
+	records, _, _ := store.List(jobstore.Filter{Since: start.Add(7 * time.Hour)}, 10, "")
+	if len(records) != 3 {
+		t.Error("Expected 3 jobs since the 7th hour, got: ", len(records))
+	}
+	records, _, _ = store.List(jobstore.Filter{ImageUrl: "http://example.com/1.jpg"}, 1, "")
+	if len(records) != 1 || records[0].ID != "job7" {
+		t.Error("Expected the last job that fetched the image, got: ", records)
+	}
+	records, _, _ = store.List(jobstore.Filter{Site: "http://other.com"}, 10, "")
+	if len(records) != 0 {
+		t.Error("Expected no jobs of another site, got: ", len(records))
+	}
+	if _, _, err := store.List(jobstore.Filter{}, 10, "zz"); err != jobstore.ErrInvalidCursor {
+		t.Error("Expected an invalid cursor error, got: ", err)
+	}
+}
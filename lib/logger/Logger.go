@@ -1,22 +1,212 @@
 package logger
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	config "propper/configs"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	config "propper/configs"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
 )
 
+var levelNames = map[Level]string{LevelDebug: "debug", LevelInfo: "info", LevelWarn: "warn", LevelError: "error"}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("invalid log level '%s'", name)
+}
+
+// Output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Writes one line per entry, with the time, level, message, the fields
+// stored in the context and the key value pairs of the call.
+type Logger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	level  Level
+	format string
+}
+
+func New(out io.Writer, level Level, format string) *Logger {
+	return &Logger{out: out, level: level, format: format}
+}
+
+var std = newFromConfig()
+
 func init() {
 	if config.DEBUG {
 		fmt.Println("DEBUG MODE IS ON")
 	}
 }
 
-func Log(i ...interface{}) {
-	if !config.DEBUG {
+// DEBUG enables the debug level regardless of LOG_LEVEL.
+func newFromConfig() *Logger {
+	level, err := ParseLevel(config.LOG_LEVEL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if config.DEBUG {
+		level = LevelDebug
+	}
+	var out io.Writer
+	switch config.LOG_OUTPUT {
+	case "", "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	default:
+		out, err = NewRotatingFile(config.LOG_OUTPUT, int64(config.LOG_MAX_SIZE)*1024*1024, config.LOG_MAX_BACKUPS)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Couldn't open the log file, logging to stdout: ", err)
+			out = os.Stdout
+		}
+	}
+	return New(out, level, config.LOG_FORMAT)
+}
+
+type fieldsKey struct{}
+
+// Returns a context whose log entries include the key value pairs, like
+// the id of the request or the job.
+func WithFields(ctx context.Context, keyvals ...interface{}) context.Context {
+	fields, _ := ctx.Value(fieldsKey{}).([]interface{})
+	merged := append(append([]interface{}{}, fields...), keyvals...)
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// Adds to ctx the fields stored in from. Lets contexts that don't derive
+// from the one of a request, like the ones of the browser tabs, log its ids.
+func WithFieldsOf(ctx, from context.Context) context.Context {
+	fields, _ := from.Value(fieldsKey{}).([]interface{})
+	if len(fields) == 0 {
+		return ctx
+	}
+	return WithFields(ctx, fields...)
+}
+
+// Value of a field stored in the context, or nil.
+func Field(ctx context.Context, key string) interface{} {
+	fields, _ := ctx.Value(fieldsKey{}).([]interface{})
+	for i := len(fields) - 2; i >= 0; i -= 2 {
+		if fields[i] == key {
+			return fields[i+1]
+		}
+	}
+	return nil
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *Logger) Log(ctx context.Context, level Level, msg string, keyvals ...interface{}) {
+	if !l.Enabled(level) {
 		return
 	}
-	now := time.Now().UTC().Format("15:04:05")
-	fmt.Printf("%s :: ", now)
-	fmt.Println(i...)
+	fields, _ := ctx.Value(fieldsKey{}).([]interface{})
+	keyvals = append(append([]interface{}{}, fields...), keyvals...)
+	if len(keyvals)%2 != 0 {
+		keyvals = append(keyvals, "(missing)")
+	}
+	now := time.Now().UTC()
+
+	var line string
+	if l.format == FormatJSON {
+		line = formatJSON(now, level, msg, keyvals)
+	} else {
+		line = formatText(now, level, msg, keyvals)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.out, line+"\n")
+}
+
+func formatText(now time.Time, level Level, msg string, keyvals []interface{}) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %-5s %s", now.Format(time.RFC3339), strings.ToUpper(level.String()), msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		value := fmt.Sprint(valueOf(keyvals[i+1]))
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %v=%s", keyvals[i], value)
+	}
+	return b.String()
+}
+
+// Keys keep their order, so entries are written by hand instead of with a map.
+func formatJSON(now time.Time, level Level, msg string, keyvals []interface{}) string {
+	var b strings.Builder
+	b.WriteString("{")
+	writePair := func(key string, value interface{}) {
+		encodedKey, _ := json.Marshal(key)
+		encodedValue, err := json.Marshal(value)
+		if err != nil {
+			encodedValue, _ = json.Marshal(fmt.Sprint(value))
+		}
+		b.Write(encodedKey)
+		b.WriteString(":")
+		b.Write(encodedValue)
+	}
+	writePair("time", now.Format(time.RFC3339Nano))
+	b.WriteString(",")
+	writePair("level", level.String())
+	b.WriteString(",")
+	writePair("msg", msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		b.WriteString(",")
+		writePair(fmt.Sprint(keyvals[i]), valueOf(keyvals[i+1]))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// Errors are written with their message, as most of them have no exported fields.
+func valueOf(value interface{}) interface{} {
+	if err, ok := value.(error); ok {
+		return err.Error()
+	}
+	return value
+}
+
+func Debug(ctx context.Context, msg string, keyvals ...interface{}) {
+	std.Log(ctx, LevelDebug, msg, keyvals...)
+}
+
+func Info(ctx context.Context, msg string, keyvals ...interface{}) {
+	std.Log(ctx, LevelInfo, msg, keyvals...)
+}
+
+func Warn(ctx context.Context, msg string, keyvals ...interface{}) {
+	std.Log(ctx, LevelWarn, msg, keyvals...)
+}
+
+func Error(ctx context.Context, msg string, keyvals ...interface{}) {
+	std.Log(ctx, LevelError, msg, keyvals...)
 }
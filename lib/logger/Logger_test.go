@@ -0,0 +1,78 @@
+package logger_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	logger "propper/lib/logger"
+)
+
+func TestTextFormatWithContextFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := logger.New(&buf, logger.LevelInfo, logger.FormatText)
+	ctx := logger.WithFields(context.Background(), "request_id", "abc")
+	ctx = logger.WithFields(ctx, "job_id", "42")
+
+	l.Log(ctx, logger.LevelDebug, "hidden")
+	l.Log(ctx, logger.LevelWarn, "Page throttled", "page", 2, "error", errors.New("too many requests"))
+
+	line := buf.String()
+	if strings.Contains(line, "hidden") {
+		t.Error("Entry under the level was written")
+	}
+	if !strings.Contains(line, `WARN  Page throttled request_id=abc job_id=42 page=2 error="too many requests"`) {
+		t.Error("Unexpected line: ", line)
+	}
+	if logger.Field(ctx, "job_id") != "42" {
+		t.Error("Field not found in the context")
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	l := logger.New(&buf, logger.LevelDebug, logger.FormatJSON)
+	l.Log(logger.WithFields(context.Background(), "job_id", "42"), logger.LevelError, "Job failed", "error", errors.New("boom"))
+
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["level"] != "error" || entry["msg"] != "Job failed" || entry["job_id"] != "42" || entry["error"] != "boom" {
+		t.Error("Unexpected entry: ", entry)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "propper.log")
+	file, err := logger.NewRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"}
+	for name, content := range expected {
+		res, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(res) != content {
+			t.Errorf("Unexpected content of %s: %q", name, res)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("Kept more backups than the max")
+	}
+}
@@ -0,0 +1,55 @@
+package proxy_test
+
+import (
+	"testing"
+	"time"
+
+	proxy "propper/lib/proxy"
+	utils "propper/test/utils"
+)
+
+func TestRoundRobinSkipsBenchedProxies(t *testing.T) {
+	pool, err := proxy.NewPool([]string{"http://user:secret@a:1", "socks5://b:2", "http://c:3"}, 2, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b, c := pool.Next(), pool.Next(), pool.Next()
+	utils.Assert(t, "http://a:1", a.String(), "Credentials should not be part of the identity")
+	utils.Assert(t, "socks5://b:2", b.String(), "Invalid proxy order")
+	utils.Assert(t, "http://c:3", c.String(), "Invalid proxy order")
+
+	pool.ReportFailure(b)
+	pool.ReportSuccess(b)
+	pool.ReportFailure(b)
+	utils.Assert(t, true, pool.IsAvailable(b), "A success should reset the failures")
+	pool.ReportFailure(b)
+	utils.Assert(t, false, pool.IsAvailable(b), "Proxy should be benched after consecutive failures")
+
+	for i := 0; i < 4; i += 1 {
+		if pool.Next() == b {
+			t.Error("Benched proxy returned")
+		}
+	}
+}
+
+func TestStickyRotation(t *testing.T) {
+	pool, _ := proxy.NewPool([]string{"http://a:1", "http://b:2"}, 1, time.Hour)
+	rotation := pool.NewRotation(proxy.Sticky)
+	first := rotation.Pick()
+	utils.Assert(t, first, rotation.Pick(), "Sticky rotation should keep the proxy")
+	rotation.ReportFailure(first)
+	second := rotation.Pick()
+	if second == first {
+		t.Error("Sticky rotation should change a benched proxy")
+	}
+	utils.Assert(t, second, rotation.Pick(), "Sticky rotation should keep the new proxy")
+}
+
+func TestEmptyPoolConnectsDirectly(t *testing.T) {
+	pool, _ := proxy.NewPool(nil, 1, time.Hour)
+	var nilProxy *proxy.Proxy
+	utils.Assert(t, nilProxy, pool.NewRotation(proxy.RoundRobin).Pick(), "Expected no proxy")
+	if _, err := proxy.NewPool([]string{"ftp://a:1"}, 1, time.Hour); err == nil {
+		t.Error("Expected error for invalid scheme")
+	}
+}
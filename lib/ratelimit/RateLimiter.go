@@ -0,0 +1,156 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Limits struct {
+	// Rate at which tokens are refilled. 0 or less means no rate limit.
+	RequestsPerSecond float64
+	// Maximum number of requests allowed at once after some idle time.
+	Burst int
+	// Minimum time between two consecutive requests.
+	MinDelay time.Duration
+}
+
+// Token bucket that also enforces a minimum delay between requests.
+type TokenBucket struct {
+	mu     sync.Mutex
+	limits Limits
+	tokens float64
+	last   time.Time
+	next   time.Time
+}
+
+func NewTokenBucket(limits Limits) *TokenBucket {
+	if limits.Burst < 1 {
+		limits.Burst = 1
+	}
+	return &TokenBucket{
+		limits: limits,
+		tokens: float64(limits.Burst),
+		last:   time.Now(),
+	}
+}
+
+// Slot reserved in a bucket, with what's needed to give it back.
+type reservation struct {
+	at       time.Time
+	token    bool
+	prevNext time.Time
+	next     time.Time
+}
+
+// Reserves the next slot and returns when it can be used.
+func (b *TokenBucket) reserve() reservation {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	r := reservation{at: now, prevNext: b.next}
+	if b.limits.RequestsPerSecond > 0 {
+		b.tokens += now.Sub(b.last).Seconds() * b.limits.RequestsPerSecond
+		if b.tokens > float64(b.limits.Burst) {
+			b.tokens = float64(b.limits.Burst)
+		}
+		b.last = now
+		if b.tokens < 1 {
+			missing := (1 - b.tokens) / b.limits.RequestsPerSecond
+			r.at = now.Add(time.Duration(missing * float64(time.Second)))
+		}
+		// the token is taken now, callers waiting later get the following ones
+		b.tokens -= 1
+		r.token = true
+	}
+	if r.at.Before(b.next) {
+		r.at = b.next
+	}
+	b.next = r.at.Add(b.limits.MinDelay)
+	r.next = b.next
+	return r
+}
+
+// Gives back an unused reservation. The minimum delay is only rolled back if
+// nobody reserved a slot after it.
+func (b *TokenBucket) cancel(r reservation) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if r.token {
+		b.tokens = math.Min(b.tokens+1, float64(b.limits.Burst))
+	}
+	if b.next.Equal(r.next) {
+		b.next = r.prevNext
+	}
+}
+
+// Blocks until the request is allowed, or ctx is done. A request whose ctx
+// is done gives its slot back to the following ones.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r := b.reserve()
+	delay := time.Until(r.at)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.cancel(r)
+		return ctx.Err()
+	}
+}
+
+// Keeps a token bucket per host, shared by everyone using the limiter.
+type HostLimiter struct {
+	mu       sync.Mutex
+	defaults Limits
+	perHost  map[string]Limits
+	buckets  map[string]*TokenBucket
+}
+
+func NewHostLimiter(defaults Limits, perHost map[string]Limits) *HostLimiter {
+	hosts := map[string]Limits{}
+	for host, limits := range perHost {
+		hosts[strings.ToLower(host)] = limits
+	}
+	return &HostLimiter{
+		defaults: defaults,
+		perHost:  hosts,
+		buckets:  map[string]*TokenBucket{},
+	}
+}
+
+func (h *HostLimiter) bucket(host string) *TokenBucket {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	bucket, ok := h.buckets[host]
+	if !ok {
+		limits, ok := h.perHost[host]
+		if !ok {
+			limits = h.defaults
+		}
+		bucket = NewTokenBucket(limits)
+		h.buckets[host] = bucket
+	}
+	return bucket
+}
+
+// Blocks until a request to the host of rawUrl is allowed, or ctx is done.
+// Urls that can't be parsed aren't limited.
+func (h *HostLimiter) Wait(ctx context.Context, rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil || len(u.Hostname()) == 0 {
+		return nil
+	}
+	return h.bucket(strings.ToLower(u.Hostname())).Wait(ctx)
+}
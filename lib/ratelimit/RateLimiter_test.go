@@ -0,0 +1,83 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ratelimit "propper/lib/ratelimit"
+)
+
+func TestBurstThenRate(t *testing.T) {
+	bucket := ratelimit.NewTokenBucket(ratelimit.Limits{RequestsPerSecond: 20, Burst: 2})
+	start := time.Now()
+	for i := 0; i < 4; i += 1 {
+		if err := bucket.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 2 requests from the burst, and 2 more at 50ms each
+	elapsed := time.Since(start)
+	if elapsed < 90*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Error("Unexpected elapsed time: ", elapsed)
+	}
+}
+
+func TestMinDelay(t *testing.T) {
+	bucket := ratelimit.NewTokenBucket(ratelimit.Limits{Burst: 10, MinDelay: 40 * time.Millisecond})
+	start := time.Now()
+	for i := 0; i < 3; i += 1 {
+		if err := bucket.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 75*time.Millisecond {
+		t.Error("Requests closer than the min delay: ", elapsed)
+	}
+}
+
+func TestWaitIsCancelable(t *testing.T) {
+	limiter := ratelimit.NewHostLimiter(ratelimit.Limits{}, map[string]ratelimit.Limits{
+		"slow.example.com": {RequestsPerSecond: 0.1, Burst: 1},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx, "https://slow.example.com/a"); err != nil {
+		t.Fatal("First request should use the burst: ", err)
+	}
+	if err := limiter.Wait(ctx, "https://SLOW.example.com/b"); err == nil {
+		t.Error("Expected the wait to be canceled")
+	}
+	// other hosts use their own bucket
+	if err := limiter.Wait(context.Background(), "https://fast.example.com/a"); err != nil {
+		t.Error("Unexpected error for another host: ", err)
+	}
+}
+
+func TestCanceledWaitsGiveTheirSlotBack(t *testing.T) {
+	for _, limits := range []ratelimit.Limits{
+		{RequestsPerSecond: 10, Burst: 1},
+		{MinDelay: 100 * time.Millisecond},
+	} {
+		bucket := ratelimit.NewTokenBucket(limits)
+		start := time.Now()
+		if err := bucket.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i += 1 {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			if err := bucket.Wait(ctx); err != context.DeadlineExceeded {
+				t.Error("Expected the wait to time out, got: ", err)
+			}
+			cancel()
+		}
+		if err := bucket.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		// the canceled waits would have pushed it to 400ms
+		elapsed := time.Since(start)
+		if elapsed < 90*time.Millisecond || elapsed > 250*time.Millisecond {
+			t.Errorf("Unexpected elapsed time with %+v: %v", limits, elapsed)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package robots
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type rule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// Rules of a robots.txt that apply to one user agent.
+type Rules struct {
+	rules      []rule
+	disallowed bool
+	CrawlDelay time.Duration
+}
+
+func AllowAll() *Rules {
+	return &Rules{}
+}
+
+func DisallowAll() *Rules {
+	return &Rules{disallowed: true}
+}
+
+// Patterns match from the start of the path, '*' matches any sequence of
+// characters and a trailing '$' anchors the end of the path.
+func patternToRegexp(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+type group struct {
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+// Parses a robots.txt, keeping the group that matches the user agent best.
+// If no group matches, the '*' group is used.
+func Parse(content string, userAgent string) *Rules {
+	groups := map[string]*group{}
+	currentAgents := []string{}
+	lastWasRule := false
+
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		switch key {
+		case "user-agent":
+			// agents listed together share the rules that follow them
+			if lastWasRule {
+				currentAgents = []string{}
+			}
+			agent := strings.ToLower(value)
+			if _, ok := groups[agent]; !ok {
+				groups[agent] = &group{}
+			}
+			currentAgents = append(currentAgents, agent)
+			lastWasRule = false
+		case "allow", "disallow":
+			lastWasRule = true
+			// an empty disallow allows everything
+			if len(value) == 0 {
+				continue
+			}
+			r := rule{allow: key == "allow", pattern: value, re: patternToRegexp(value)}
+			for _, agent := range currentAgents {
+				groups[agent].rules = append(groups[agent].rules, r)
+			}
+		case "crawl-delay":
+			lastWasRule = true
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+			for _, agent := range currentAgents {
+				groups[agent].crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+
+	userAgent = strings.ToLower(userAgent)
+	selected, selectedAgent := groups["*"], ""
+	for agent, g := range groups {
+		if agent != "*" && strings.Contains(userAgent, agent) && len(agent) > len(selectedAgent) {
+			selected, selectedAgent = g, agent
+		}
+	}
+	if selected == nil {
+		return AllowAll()
+	}
+	return &Rules{rules: selected.rules, CrawlDelay: selected.crawlDelay}
+}
+
+// Tells if the path (with its query) can be crawled. The longest matching
+// rule wins, and allow wins over disallow on ties.
+func (r *Rules) Allowed(path string) bool {
+	if r.disallowed {
+		return false
+	}
+	if len(path) == 0 {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	allowed, matchLength := true, -1
+	for _, rule := range r.rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+		if len(rule.pattern) > matchLength || (len(rule.pattern) == matchLength && rule.allow) {
+			allowed, matchLength = rule.allow, len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+func (r *Rules) AllowedURL(u *url.URL) bool {
+	path := u.EscapedPath()
+	if len(u.RawQuery) > 0 {
+		path += "?" + u.RawQuery
+	}
+	return r.Allowed(path)
+}
+
+type cachedRules struct {
+	rules   *Rules
+	expires time.Time
+}
+
+// Fetches and caches the robots.txt of each host.
+type Checker struct {
+	mu        sync.Mutex
+	client    *http.Client
+	userAgent string
+	ttl       time.Duration
+	cache     map[string]cachedRules
+}
+
+// Rules of hosts whose robots.txt failed with a server error are kept for this time.
+const failedFetchTTL = time.Minute
+
+func NewChecker(userAgent string, ttl time.Duration, client *http.Client) *Checker {
+	return &Checker{
+		client:    client,
+		userAgent: userAgent,
+		ttl:       ttl,
+		cache:     map[string]cachedRules{},
+	}
+}
+
+// Returns the rules for the host of the url. As robots.txt RFC 9309 says,
+// a missing robots.txt (4xx) allows everything, while a server error
+// disallows everything. Fails if the host can't be reached.
+func (c *Checker) Rules(ctx context.Context, u *url.URL) (*Rules, error) {
+	origin := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+	c.mu.Lock()
+	cached, ok := c.cache[origin]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.rules, nil
+	}
+
+	rules, ttl, err := c.fetch(ctx, origin)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.cache[origin] = cachedRules{rules: rules, expires: time.Now().Add(ttl)}
+	c.mu.Unlock()
+	return rules, nil
+}
+
+func (c *Checker) fetch(ctx context.Context, origin string) (*Rules, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 500 {
+		return DisallowAll(), failedFetchTTL, nil
+	}
+	if res.StatusCode >= 400 {
+		return AllowAll(), c.ttl, nil
+	}
+	// robots.txt files bigger than 500 KiB can be truncated
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, 500*1024))
+	if err != nil && len(body) == 0 {
+		return nil, 0, err
+	}
+	return Parse(string(body), c.userAgent), c.ttl, nil
+}
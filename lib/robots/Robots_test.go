@@ -0,0 +1,90 @@
+package robots_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	robots "propper/lib/robots"
+	utils "propper/test/utils"
+)
+
+const robotsTxt = `
+# comment
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.gif$
+Crawl-delay: 2
+
+User-agent: other-bot
+User-agent: cheezburger-scraper
+Disallow: /page/
+Allow: /page/1$
+Crawl-delay: 0.5
+`
+
+func TestRulesForGenericAgent(t *testing.T) {
+	rules := robots.Parse(robotsTxt, "some-bot/1.0")
+	utils.Assert(t, 2*time.Second, rules.CrawlDelay, "Invalid crawl delay")
+	cases := map[string]bool{
+		"/":                     true,
+		"/private":              false,
+		"/private/public/a.jpg": true,
+		"/a.gif":                false,
+		"/a.gif?w=2":            true,
+		"/page/3":               true,
+	}
+	for path, allowed := range cases {
+		utils.Assert(t, allowed, rules.Allowed(path), "Invalid result for path "+path)
+	}
+}
+
+func TestRulesForSpecificAgent(t *testing.T) {
+	rules := robots.Parse(robotsTxt, "Cheezburger-Scraper/2.0")
+	utils.Assert(t, 500*time.Millisecond, rules.CrawlDelay, "Invalid crawl delay")
+	utils.Assert(t, true, rules.Allowed("/private"), "Specific group should replace the generic one")
+	utils.Assert(t, true, rules.Allowed("/page/1"), "Invalid result for allowed page")
+	utils.Assert(t, false, rules.Allowed("/page/2"), "Invalid result for disallowed page")
+}
+
+func TestCheckerStatusCodes(t *testing.T) {
+	status := http.StatusNotFound
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests += 1
+		w.WriteHeader(status)
+		fmt.Fprint(w, "User-agent: *\nDisallow: /")
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL + "/page/2")
+
+	checker := robots.NewChecker("bot", time.Hour, ts.Client())
+	rules, err := checker.Rules(context.Background(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(t, true, rules.AllowedURL(u), "Missing robots.txt should allow everything")
+	checker.Rules(context.Background(), u)
+	utils.Assert(t, 1, requests, "robots.txt should be cached")
+
+	status = http.StatusServiceUnavailable
+	checker = robots.NewChecker("bot", time.Hour, ts.Client())
+	rules, err = checker.Rules(context.Background(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(t, false, rules.AllowedURL(u), "Server errors should disallow everything")
+
+	status = http.StatusOK
+	checker = robots.NewChecker("bot", time.Hour, ts.Client())
+	rules, err = checker.Rules(context.Background(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(t, false, rules.AllowedURL(u), "Invalid result for disallowed url")
+}
@@ -1,30 +1,141 @@
 package semaphore
 
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrTooLarge = errors.New("semaphore: acquiring more than its capacity")
+var ErrNegative = errors.New("semaphore: negative number of units")
+var ErrReleasedTooMuch = errors.New("semaphore: released more than held")
+
+type waiter struct {
+	n     int
+	ready chan struct{}
+}
+
+// Weighted semaphore. Waiters are served in the order they arrived, so a
+// large request isn't starved by smaller ones.
 type CustomSemaphore struct {
-	sem chan int
+	mu       sync.Mutex
+	capacity int
+	inFlight int
+	waiters  list.List
 }
 
 func NewCustomSemaphore(capacity int) *CustomSemaphore {
-	return &CustomSemaphore{
-		sem: make(chan int, capacity),
-	}
+	return &CustomSemaphore{capacity: capacity}
 }
 
-func (s *CustomSemaphore) CurrentlyRunning() int {
-	return len(s.sem)
+// Waits until n units are available, or ctx is done. Fails right away with
+// ErrTooLarge if n is greater than the capacity, as it could never be
+// acquired, and with ErrNegative if n is negative.
+func (s *CustomSemaphore) Acquire(ctx context.Context, n int) error {
+	if n < 0 {
+		return ErrNegative
+	}
+	s.mu.Lock()
+	if n > s.capacity {
+		s.mu.Unlock()
+		return ErrTooLarge
+	}
+	if s.capacity-s.inFlight >= n && s.waiters.Len() == 0 {
+		s.inFlight += n
+		s.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	elem := s.waiters.PushBack(waiter{n: n, ready: ready})
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-ready:
+			// acquired right when ctx was done, keep it as the caller will release it
+			s.mu.Unlock()
+			return nil
+		default:
+		}
+		isFront := s.waiters.Front() == elem
+		s.waiters.Remove(elem)
+		// the waiters behind may fit now that this one left the front
+		if isFront {
+			s.notifyWaiters()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
 }
 
-func (s *CustomSemaphore) Close() {
-	close(s.sem)
+// Acquires n units only if they are available right now.
+func (s *CustomSemaphore) TryAcquire(n int) bool {
+	if n < 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.capacity-s.inFlight >= n && s.waiters.Len() == 0 {
+		s.inFlight += n
+		return true
+	}
+	return false
 }
 
-func (s *CustomSemaphore) Take() {
-	s.sem <- 1
+// Returns n units. Releasing more units than acquired is a bug in the
+// caller, reported with ErrReleasedTooMuch. The units in flight are left at
+// 0 instead of failing, as it's called from goroutines that can't recover.
+func (s *CustomSemaphore) Release(n int) error {
+	if n < 0 {
+		return ErrNegative
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	if n > s.inFlight {
+		n, err = s.inFlight, ErrReleasedTooMuch
+	}
+	s.inFlight -= n
+	s.notifyWaiters()
+	return err
 }
 
-func (s *CustomSemaphore) Signal() {
-	if len(s.sem) <= 0 {
-		return
+// Must be called holding the lock.
+func (s *CustomSemaphore) notifyWaiters() {
+	for {
+		next := s.waiters.Front()
+		if next == nil {
+			return
+		}
+		w := next.Value.(waiter)
+		if s.capacity-s.inFlight < w.n {
+			return
+		}
+		s.inFlight += w.n
+		s.waiters.Remove(next)
+		close(w.ready)
 	}
-	<-s.sem
+}
+
+// Units currently acquired.
+func (s *CustomSemaphore) InFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inFlight
+}
+
+// Callers waiting in Acquire.
+func (s *CustomSemaphore) Waiting() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.waiters.Len()
+}
+
+func (s *CustomSemaphore) Capacity() int {
+	return s.capacity
 }
@@ -0,0 +1,104 @@
+package semaphore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sem "propper/lib/semaphore"
+)
+
+func TestAcquireAndRelease(t *testing.T) {
+	s := sem.NewCustomSemaphore(3)
+	if err := s.Acquire(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+	if s.TryAcquire(2) {
+		t.Fatal("Acquired more than the capacity")
+	}
+	if !s.TryAcquire(1) {
+		t.Fatal("Couldn't acquire the free unit")
+	}
+	if s.InFlight() != 3 {
+		t.Error("Unexpected units in flight: ", s.InFlight())
+	}
+	s.Release(3)
+	if s.InFlight() != 0 {
+		t.Error("Unexpected units in flight after releasing: ", s.InFlight())
+	}
+}
+
+func TestAcquireIsCancelable(t *testing.T) {
+	s := sem.NewCustomSemaphore(1)
+	s.Acquire(context.Background(), 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Acquire(ctx, 1); err != context.DeadlineExceeded {
+		t.Fatal("Expected the deadline error, got: ", err)
+	}
+	if s.Waiting() != 0 {
+		t.Error("Canceled waiter still queued")
+	}
+	s.Release(1)
+	if !s.TryAcquire(1) {
+		t.Error("Canceled waiter kept the unit")
+	}
+}
+
+func TestWaitersAreServedInOrder(t *testing.T) {
+	s := sem.NewCustomSemaphore(2)
+	s.Acquire(context.Background(), 2)
+
+	acquired := make(chan int, 2)
+	go func() {
+		s.Acquire(context.Background(), 2)
+		acquired <- 2
+	}()
+	for s.Waiting() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		s.Acquire(context.Background(), 1)
+		acquired <- 1
+	}()
+	for s.Waiting() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	// the small request doesn't pass the large one that arrived first
+	if s.TryAcquire(1) {
+		t.Fatal("TryAcquire skipped the queue")
+	}
+	s.Release(2)
+	if first := <-acquired; first != 2 {
+		t.Fatal("Waiters served out of order")
+	}
+	s.Release(2)
+	<-acquired
+}
+
+func TestMisuse(t *testing.T) {
+	s := sem.NewCustomSemaphore(1)
+	if err := s.Acquire(context.Background(), 2); err != sem.ErrTooLarge {
+		t.Error("Expected an error acquiring more than the capacity, got: ", err)
+	}
+	if err := s.Acquire(context.Background(), -1); err != sem.ErrNegative {
+		t.Error("Expected an error acquiring a negative number of units, got: ", err)
+	}
+	if s.TryAcquire(-1) {
+		t.Error("Acquired a negative number of units")
+	}
+	if err := s.Release(1); err != sem.ErrReleasedTooMuch {
+		t.Error("Expected an error releasing more than held, got: ", err)
+	}
+	s.Acquire(context.Background(), 1)
+	if err := s.Release(2); err != sem.ErrReleasedTooMuch {
+		t.Error("Expected an error releasing more than held, got: ", err)
+	}
+	if s.InFlight() != 0 {
+		t.Error("The units in flight should be left at 0, got: ", s.InFlight())
+	}
+	if !s.TryAcquire(1) {
+		t.Error("The semaphore should still be usable")
+	}
+}
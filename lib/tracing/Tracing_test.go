@@ -0,0 +1,51 @@
+package tracing_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	tracing "propper/lib/tracing"
+)
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := tracing.Setup(context.Background(), tracing.Options{
+		ServiceName: "propper-test",
+		Exporter:    tracing.ExporterFile,
+		File:        path,
+		SampleRatio: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "GetImages")
+	_, child := otel.Tracer("test").Start(ctx, "navigate")
+	child.SetAttributes(attribute.Int("page", 2))
+	child.End()
+	parent.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{`"Name":"GetImages"`, `"Name":"navigate"`, `"Key":"page"`, "propper-test"} {
+		if !strings.Contains(string(res), expected) {
+			t.Error("Missing in the exported spans: ", expected)
+		}
+	}
+}
+
+func TestInvalidExporter(t *testing.T) {
+	if _, err := tracing.Setup(context.Background(), tracing.Options{Exporter: "zipkin"}); err == nil {
+		t.Error("Expected an error for an unknown exporter")
+	}
+}
@@ -1,44 +1,192 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
+	"time"
 
 	config "propper/configs"
+	imagesController "propper/controllers/images"
+	circuitbreaker "propper/lib/circuitbreaker"
+	logger "propper/lib/logger"
+	tracing "propper/lib/tracing"
 	middlewares "propper/middlewares"
 	imagesRoutes "propper/routes/images"
+	memesRoutes "propper/routes/memes"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+type status struct {
+	CircuitBreakers map[string]circuitbreaker.Status `json:"circuit_breakers"`
+}
+
 func reportStatus(w http.ResponseWriter, r *http.Request) {
+	payload, err := json.Marshal(&status{CircuitBreakers: imagesController.CircuitBreakers()})
+	if err != nil {
+		http.Error(w, "error encoding return payload", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(payload)
+}
+
+// The process is up and serving requests.
+func reportHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+type readiness struct {
+	Ready  bool                              `json:"ready"`
+	Checks map[string]imagesController.Check `json:"checks"`
+}
+
+// Answers 503 while the requests to download images would fail or wait for long.
+func reportReadiness(w http.ResponseWriter, r *http.Request) {
+	ready, checks := imagesController.Readiness()
+	payload, err := json.Marshal(&readiness{Ready: ready, Checks: checks})
+	if err != nil {
+		http.Error(w, "error encoding return payload", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if ready {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(payload)
 }
 
 func genericHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func handleRequest() {
+func newServer() *http.Server {
 	mainRouter := mux.NewRouter().StrictSlash(true)
+	mainRouter.Use(middlewares.Metrics)
 	mainRouter.HandleFunc("/status", reportStatus)
+	mainRouter.HandleFunc("/healthz", reportHealth)
+	mainRouter.HandleFunc("/readyz", reportReadiness)
+	mainRouter.Handle("/metrics", promhttp.Handler())
 
 	imagesSubRoute := mainRouter.PathPrefix("/images").Subrouter()
 	imagesSubRoute.Use(middlewares.SetCorsHeaders)
 	imagesSubRoute.HandleFunc("/download", imagesRoutes.GetImages)
+	imagesSubRoute.HandleFunc("/similar", imagesRoutes.GetSimilarImages)
+	imagesSubRoute.HandleFunc("/jobs", imagesRoutes.GetJobs).Methods(http.MethodGet)
+	imagesSubRoute.HandleFunc("/jobs/{id}/resume", imagesRoutes.ResumeJob).Methods(http.MethodPost)
+
+	memesSubRoute := mainRouter.PathPrefix("/memes").Subrouter()
+	memesSubRoute.Use(middlewares.SetCorsHeaders)
+	memesSubRoute.HandleFunc("/search", memesRoutes.Search).Methods(http.MethodGet)
 
-	fmt.Println("Running on " + config.PORT)
-	log.Fatal(http.ListenAndServe(":"+config.PORT, mainRouter))
+	// outside of the router, so requests to unknown routes are logged too
+	handler := middlewares.RequestID(middlewares.TraceContext(middlewares.AccessLog(mainRouter)))
+	return &http.Server{Addr: ":" + config.PORT, Handler: handler}
+}
+
+// Time the handlers of the canceled jobs have to answer before exiting.
+const shutdownGrace = 10 * time.Second
+
+// Stops listening and waits up to SHUTDOWN_DRAIN_TIME for the running jobs.
+// The ones still running after it are canceled, and saved as interrupted.
+func shutdown(server *http.Server) {
+	ctx := context.Background()
+	imagesController.StopAcceptingJobs()
+	drain := time.Duration(config.SHUTDOWN_DRAIN_TIME) * time.Second
+	serverCtx, cancelServer := context.WithTimeout(ctx, drain+shutdownGrace)
+	defer cancelServer()
+	serverDone := make(chan error, 1)
+	go func() {
+		serverDone <- server.Shutdown(serverCtx)
+	}()
 
+	drainCtx, cancelDrain := context.WithTimeout(ctx, drain)
+	defer cancelDrain()
+	if err := imagesController.WaitJobs(drainCtx); err != nil {
+		canceled := imagesController.CancelJobs()
+		logger.Warn(ctx, "Canceled the jobs still running after the drain time", "jobs", canceled)
+		imagesController.WaitJobs(serverCtx)
+	}
+	if err := <-serverDone; err != nil {
+		logger.Warn(ctx, "Requests still in progress when exiting", "error", err)
+	}
+	imagesController.CloseBrowsers()
 }
+
 func main() {
 	cores := runtime.NumCPU()
 	runtime.GOMAXPROCS(cores)
 	go func() {
 		log.Println(http.ListenAndServe("localhost:6060", nil))
 	}()
-	handleRequest()
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		ServiceName: "propper",
+		Exporter:    config.TRACING_EXPORTER,
+		Endpoint:    config.OTLP_ENDPOINT,
+		Insecure:    config.OTLP_INSECURE,
+		File:        config.TRACING_FILE,
+		SampleRatio: config.TRACING_SAMPLE_RATIO,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := imagesController.CheckConfig(); err != nil {
+		log.Fatal(err)
+	}
+	if err := imagesController.LoadProxies(); err != nil {
+		log.Fatal(err)
+	}
+	if err := imagesController.LoadSites(); err != nil {
+		log.Fatal(err)
+	}
+	imagesController.LoadBrowsers()
+	if err := imagesController.OpenHistory(); err != nil {
+		log.Fatal(err)
+	}
+	defer imagesController.CloseHistory()
+	if err := imagesController.OpenCatalog(); err != nil {
+		log.Fatal(err)
+	}
+	defer imagesController.CloseCatalog()
+	// jobs left running by a crash become resumable
+	if err := imagesController.RecoverJobs(); err != nil {
+		log.Fatal(err)
+	}
+
+	server := newServer()
+	serverErr := make(chan error, 1)
+	go func() {
+		fmt.Println("Running on " + config.PORT)
+		serverErr <- server.ListenAndServe()
+	}()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err = <-serverErr:
+	case sig := <-signals:
+		logger.Info(context.Background(), "Shutting down", "signal", sig)
+		// a second signal exits right away
+		signal.Reset(syscall.SIGINT, syscall.SIGTERM)
+		shutdown(server)
+	}
+	// sends the spans still buffered
+	shutdownTracing(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,46 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	logger "propper/lib/logger"
+)
+
+type panicResponse struct {
+	Err       string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Logs every request once it's served. A panic in the handlers is logged
+// with its stack, and answered with a 500 instead of dropping the connection.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := newResponseRecorder(w)
+		defer func() {
+			if rec := recover(); rec != nil {
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+				logger.Error(r.Context(), "Panic serving request", "panic", rec, "stack", string(debug.Stack()))
+				if !recorder.wroteHeader {
+					payload, _ := json.Marshal(&panicResponse{Err: "Internal server error", RequestID: RequestIDOf(r.Context())})
+					recorder.Header().Set("Content-Type", "application/json")
+					recorder.WriteHeader(http.StatusInternalServerError)
+					recorder.Write(payload)
+				}
+			}
+			logger.Info(r.Context(), "Request served",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", recorder.status,
+				"bytes", recorder.bytes,
+				"duration_ms", time.Since(start).Milliseconds(),
+			)
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
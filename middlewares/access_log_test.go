@@ -0,0 +1,65 @@
+package middlewares_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	middlewares "propper/middlewares"
+	utils "propper/test/utils"
+	errors "propper/types/errors"
+)
+
+func TestRequestIDIsPropagated(t *testing.T) {
+	var seen string
+	handler := middlewares.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = middlewares.RequestIDOf(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	req.Header.Set(middlewares.RequestIDHeader, "client-id-1")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	utils.Assert(t, "client-id-1", seen, "Request id of the client not kept")
+	utils.Assert(t, "client-id-1", res.Header().Get(middlewares.RequestIDHeader), "Request id not sent back")
+
+	req = httptest.NewRequest(http.MethodGet, "/status", nil)
+	req.Header.Set(middlewares.RequestIDHeader, "invalid id\n")
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if seen == "invalid id\n" || len(seen) == 0 {
+		t.Error("Expected a new request id, got: ", seen)
+	}
+	utils.Assert(t, seen, res.Header().Get(middlewares.RequestIDHeader), "Assigned request id not sent back")
+}
+
+func TestErrorsIncludeTheRequestID(t *testing.T) {
+	handler := middlewares.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		middlewares.WriteError(w, r, &errors.ResponseError{Err: "Invalid amount", StatusCode: http.StatusBadRequest})
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/images/download", nil)
+	req.Header.Set(middlewares.RequestIDHeader, "client-id-2")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	utils.Assert(t, http.StatusBadRequest, res.Code, "Invalid status")
+	utils.Assert(t, "Error: Invalid amount (request id: client-id-2)\n", res.Body.String(), "Invalid error")
+}
+
+func TestPanicIsRecovered(t *testing.T) {
+	handler := middlewares.RequestID(middlewares.AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/images/download", nil)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	utils.Assert(t, http.StatusInternalServerError, res.Code, "Invalid status after a panic")
+	body := map[string]string{}
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	utils.Assert(t, res.Header().Get(middlewares.RequestIDHeader), body["request_id"], "Request id missing from the error")
+}
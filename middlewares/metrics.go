@@ -0,0 +1,83 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "propper_http_requests_total",
+		Help: "Http requests, by route, method and status.",
+	}, []string{"route", "method", "status"})
+	// from 5ms to 5 minutes, as the requests wait for whole jobs
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "propper_http_request_duration_seconds",
+		Help:    "Duration of the http requests, by route, method and status.",
+		Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"route", "method", "status"})
+)
+
+// Keeps the status and size of the response written by the handlers.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.wroteHeader {
+		return
+	}
+	r.status = status
+	r.wroteHeader = true
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Route template of the request, so urls with ids don't create a series each.
+func routeOf(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return r.URL.Path
+}
+
+// Counts the requests and their duration. Requests whose handler panics are
+// counted as a 500, the response AccessLog answers them with.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := newResponseRecorder(w)
+		completed := false
+		defer func() {
+			status := recorder.status
+			if !completed && !recorder.wroteHeader {
+				status = http.StatusInternalServerError
+			}
+			labels := []string{routeOf(r), r.Method, strconv.Itoa(status)}
+			requestsTotal.WithLabelValues(labels...).Inc()
+			requestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+		}()
+		next.ServeHTTP(recorder, r)
+		completed = true
+	})
+}
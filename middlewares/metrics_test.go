@@ -0,0 +1,41 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	middlewares "propper/middlewares"
+)
+
+func scrape() string {
+	res := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return res.Body.String()
+}
+
+func TestPanicsAreCounted(t *testing.T) {
+	handler := middlewares.AccessLog(middlewares.Metrics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	for _, path := range []string{"/panic", "/ok"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	res := scrape()
+	for _, line := range []string{
+		`propper_http_requests_total{method="GET",route="/panic",status="500"} 1`,
+		`propper_http_requests_total{method="GET",route="/ok",status="204"} 1`,
+		`propper_http_request_duration_seconds_count{method="GET",route="/panic",status="500"} 1`,
+	} {
+		if !strings.Contains(res, line+"\n") {
+			t.Error("Missing line: ", line)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	middlewares "propper/middlewares"
+	utils "propper/test/utils"
+)
+
+func TestTraceOfTheClientIsContinued(t *testing.T) {
+	previous := otel.GetTextMapPropagator()
+	defer otel.SetTextMapPropagator(previous)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var parent trace.SpanContext
+	handler := middlewares.TraceContext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parent = trace.SpanContextFromContext(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/images/download", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	utils.Assert(t, "4bf92f3577b34da6a3ce929d0e0e4736", parent.TraceID().String(), "Invalid trace id")
+	utils.Assert(t, "00f067aa0ba902b7", parent.SpanID().String(), "Invalid parent span id")
+	utils.Assert(t, true, parent.IsRemote(), "The parent span should be remote")
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/images/download", nil))
+	utils.Assert(t, false, parent.IsValid(), "Requests without traceparent shouldn't have a parent")
+}
@@ -1,15 +1,25 @@
 package images
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	config "propper/configs"
 	imagesController "propper/controllers/images"
+	jobstore "propper/lib/jobstore"
+	middlewares "propper/middlewares"
 	. "propper/types/errors"
+
+	"github.com/gorilla/mux"
 )
 
-func getImagesParameters(parameters map[string][]string) (int, int, error) {
+func getImagesParameters(parameters map[string][]string) (int, int, time.Duration, error) {
 	var err error
 
 	// default value if param isn't sent
@@ -18,7 +28,7 @@ func getImagesParameters(parameters map[string][]string) (int, int, error) {
 	if ok {
 		amount, err = strconv.ParseUint(paramAmount[0], 10, 32)
 		if err != nil {
-			return 0, 0, &InvalidParametersError{Err: "Error reading 'amount' parameter: " + err.Error()}
+			return 0, 0, 0, &InvalidParametersError{Err: "Error reading 'amount' parameter: " + err.Error()}
 		}
 	}
 
@@ -28,15 +38,50 @@ func getImagesParameters(parameters map[string][]string) (int, int, error) {
 	if ok {
 		threads, err = strconv.ParseUint(paramThreads[0], 10, 32)
 		if err != nil {
-			return 0, 0, &InvalidParametersError{Err: "Error reading 'threads' parameter: " + err.Error()}
+			return 0, 0, 0, &InvalidParametersError{Err: "Error reading 'threads' parameter: " + err.Error()}
+		}
+	}
+
+	timeout, err := getTimeoutParameter(parameters)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return int(amount), int(threads), timeout, nil
+}
+
+func getTimeoutParameter(parameters map[string][]string) (time.Duration, error) {
+	// default value if param isn't sent, requests can't take longer than the server's timeout
+	var timeout uint64 = uint64(config.TIMEOUT)
+	paramTimeout, ok := parameters["timeout"]
+	if ok {
+		var err error
+		timeout, err = strconv.ParseUint(paramTimeout[0], 10, 32)
+		if err != nil {
+			return 0, &InvalidParametersError{Err: "Error reading 'timeout' parameter: " + err.Error()}
+		}
+		if timeout == 0 {
+			return 0, &InvalidParametersError{Err: "timeout must be greater or equal than 1."}
 		}
+		if timeout > uint64(config.TIMEOUT) {
+			timeout = uint64(config.TIMEOUT)
+		}
+	}
+	return time.Duration(timeout) * time.Second, nil
+}
+
+// Context of the job of a request, which stops if the client disconnects.
+// Timeouts as long as the server's are left to the job, so the deadline set
+// here is always the client's.
+func jobContext(r *http.Request, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout >= time.Duration(config.TIMEOUT)*time.Second {
+		return context.WithCancel(r.Context())
 	}
-	return int(amount), int(threads), nil
+	return context.WithTimeout(r.Context(), timeout)
 }
 
 func GetImages(w http.ResponseWriter, r *http.Request) {
 	var err error
-	amount, threads, err := getImagesParameters(r.URL.Query())
+	amount, threads, timeout, err := getImagesParameters(r.URL.Query())
 	if err != nil {
 		var responseError *ResponseError
 		switch e := err.(type) {
@@ -45,10 +90,26 @@ func GetImages(w http.ResponseWriter, r *http.Request) {
 		default:
 			responseError = &ResponseError{Err: e.Error(), StatusCode: http.StatusInternalServerError}
 		}
-		http.Error(w, responseError.Error(), responseError.StatusCode)
+		middlewares.WriteError(w, r, responseError)
 		return
 	}
-	urls, err := imagesController.GetImages(amount, threads)
+	ctx, cancel := jobContext(r, timeout)
+	defer cancel()
+	var urls []string
+	if since := r.URL.Query().Get("since"); len(since) > 0 {
+		// amount is only a limit of the new memes
+		if _, ok := r.URL.Query()["amount"]; !ok {
+			amount = config.SINCE_DEFAULT_AMOUNT
+		}
+		urls, err = imagesController.GetNewImages(ctx, since, amount, threads)
+	} else {
+		urls, err = imagesController.GetImages(ctx, amount, threads)
+	}
+	writeJobResult(w, r, urls, err)
+}
+
+// Responds with the urls of the images of a job, or with its error.
+func writeJobResult(w http.ResponseWriter, r *http.Request, urls []string, err error) {
 	if err != nil {
 		var responseError *ResponseError
 		switch e := err.(type) {
@@ -56,17 +117,194 @@ func GetImages(w http.ResponseWriter, r *http.Request) {
 			responseError = &ResponseError{Err: e.Error(), StatusCode: http.StatusBadRequest}
 		case *NotFoundError:
 			responseError = &ResponseError{Err: e.Error(), StatusCode: http.StatusNotFound}
+		case *RobotsDisallowedError:
+			responseError = &ResponseError{Err: e.Error(), StatusCode: http.StatusForbidden}
+		case *TimeoutError:
+			responseError = &ResponseError{Err: e.Error(), StatusCode: http.StatusGatewayTimeout}
+		case *SiteUnavailableError:
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+			responseError = &ResponseError{Err: e.Error(), StatusCode: http.StatusServiceUnavailable}
+		case *ShuttingDownError:
+			responseError = &ResponseError{Err: e.Error(), StatusCode: http.StatusServiceUnavailable}
 		default:
 			responseError = &ResponseError{Err: e.Error(), StatusCode: http.StatusInternalServerError}
 		}
-		http.Error(w, responseError.Error(), responseError.StatusCode)
+		middlewares.WriteError(w, r, responseError)
 		return
 	}
 
 	payload, err := json.Marshal(urls)
 	if err != nil {
 		responseError := &ResponseError{Err: "error encoding return payload", StatusCode: http.StatusInternalServerError}
-		http.Error(w, responseError.Error(), responseError.StatusCode)
+		middlewares.WriteError(w, r, responseError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(payload)
+}
+
+// Resumes the job interrupted by a shutdown or a crash with the id of the path.
+func ResumeJob(w http.ResponseWriter, r *http.Request) {
+	// the amount and threads of the job are the ones it was started with
+	timeout, err := getTimeoutParameter(r.URL.Query())
+	if err != nil {
+		middlewares.WriteError(w, r, &ResponseError{Err: err.Error(), StatusCode: http.StatusBadRequest})
+		return
+	}
+	ctx, cancel := jobContext(r, timeout)
+	defer cancel()
+	urls, err := imagesController.ResumeJob(ctx, mux.Vars(r)["id"])
+	writeJobResult(w, r, urls, err)
+}
+
+func getSimilarImagesParameters(parameters map[string][]string) (string, string, int, error) {
+	paramHash, ok := parameters["hash"]
+	if !ok || len(paramHash[0]) == 0 {
+		return "", "", 0, &InvalidParametersError{Err: "'hash' parameter is required"}
+	}
+
+	// default value if param isn't sent
+	algorithm := "phash"
+	paramAlgorithm, ok := parameters["algorithm"]
+	if ok {
+		algorithm = paramAlgorithm[0]
+	}
+
+	// default value if param isn't sent
+	var distance uint64 = uint64(config.NEAR_DUPLICATE_DISTANCE)
+	paramDistance, ok := parameters["distance"]
+	if ok {
+		var err error
+		distance, err = strconv.ParseUint(paramDistance[0], 10, 32)
+		if err != nil {
+			return "", "", 0, &InvalidParametersError{Err: "Error reading 'distance' parameter: " + err.Error()}
+		}
+	}
+	return paramHash[0], algorithm, int(distance), nil
+}
+
+func GetSimilarImages(w http.ResponseWriter, r *http.Request) {
+	hash, algorithm, distance, err := getSimilarImagesParameters(r.URL.Query())
+	if err != nil {
+		responseError := &ResponseError{Err: err.Error(), StatusCode: http.StatusBadRequest}
+		middlewares.WriteError(w, r, responseError)
+		return
+	}
+	images, err := imagesController.FindSimilarImages(hash, algorithm, distance)
+	if err != nil {
+		var responseError *ResponseError
+		switch e := err.(type) {
+		case *InvalidParametersError:
+			responseError = &ResponseError{Err: e.Error(), StatusCode: http.StatusBadRequest}
+		default:
+			responseError = &ResponseError{Err: e.Error(), StatusCode: http.StatusInternalServerError}
+		}
+		middlewares.WriteError(w, r, responseError)
+		return
+	}
+
+	payload, err := json.Marshal(images)
+	if err != nil {
+		responseError := &ResponseError{Err: "error encoding return payload", StatusCode: http.StatusInternalServerError}
+		middlewares.WriteError(w, r, responseError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(payload)
+}
+
+const maxJobsLimit = 500
+
+var jobStatuses = []string{imagesController.JobRunning, imagesController.JobFinished, imagesController.JobFailed, imagesController.JobInterrupted}
+
+// Dates are accepted with or without time.
+func parseSince(value string) (time.Time, error) {
+	if since, err := time.Parse(time.RFC3339, value); err == nil {
+		return since, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func getJobsParameters(parameters map[string][]string) (jobstore.Filter, int, string, error) {
+	filter := jobstore.Filter{}
+	if paramStatus, ok := parameters["status"]; ok {
+		filter.Status = paramStatus[0]
+		valid := false
+		for _, status := range jobStatuses {
+			valid = valid || status == filter.Status
+		}
+		if !valid {
+			return filter, 0, "", &InvalidParametersError{Err: fmt.Sprintf("status must be one of %s", strings.Join(jobStatuses, ", "))}
+		}
+	}
+	if paramSite, ok := parameters["site"]; ok {
+		filter.Site = paramSite[0]
+	}
+	if paramUrl, ok := parameters["url"]; ok {
+		filter.ImageUrl = paramUrl[0]
+	}
+	if paramSince, ok := parameters["since"]; ok {
+		since, err := parseSince(paramSince[0])
+		if err != nil {
+			return filter, 0, "", &InvalidParametersError{Err: "Error reading 'since' parameter, expected a date or a RFC 3339 time: " + err.Error()}
+		}
+		filter.Since = since
+	}
+
+	// default value if param isn't sent
+	var limit uint64 = 50
+	paramLimit, ok := parameters["limit"]
+	if ok {
+		var err error
+		limit, err = strconv.ParseUint(paramLimit[0], 10, 32)
+		if err != nil {
+			return filter, 0, "", &InvalidParametersError{Err: "Error reading 'limit' parameter: " + err.Error()}
+		}
+		if limit < 1 || limit > maxJobsLimit {
+			return filter, 0, "", &InvalidParametersError{Err: fmt.Sprintf("limit must be greater or equal than 1, and lesser or equal than %d.", maxJobsLimit)}
+		}
+	}
+
+	cursor := ""
+	if paramCursor, ok := parameters["cursor"]; ok {
+		cursor = paramCursor[0]
+	}
+	return filter, int(limit), cursor, nil
+}
+
+type jobsPage struct {
+	Jobs []jobstore.Record `json:"jobs"`
+	// empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func GetJobs(w http.ResponseWriter, r *http.Request) {
+	filter, limit, cursor, err := getJobsParameters(r.URL.Query())
+	if err != nil {
+		middlewares.WriteError(w, r, &ResponseError{Err: err.Error(), StatusCode: http.StatusBadRequest})
+		return
+	}
+	jobs, next, err := imagesController.ListJobs(filter, limit, cursor)
+	if err != nil {
+		var responseError *ResponseError
+		switch e := err.(type) {
+		case *InvalidParametersError:
+			responseError = &ResponseError{Err: e.Error(), StatusCode: http.StatusBadRequest}
+		default:
+			responseError = &ResponseError{Err: e.Error(), StatusCode: http.StatusInternalServerError}
+		}
+		middlewares.WriteError(w, r, responseError)
+		return
+	}
+
+	payload, err := json.Marshal(&jobsPage{Jobs: jobs, NextCursor: next})
+	if err != nil {
+		responseError := &ResponseError{Err: "error encoding return payload", StatusCode: http.StatusInternalServerError}
+		middlewares.WriteError(w, r, responseError)
 		return
 	}
 
@@ -0,0 +1,94 @@
+package memes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	imagesController "propper/controllers/images"
+	catalog "propper/lib/catalog"
+	middlewares "propper/middlewares"
+	. "propper/types/errors"
+)
+
+const maxSearchLimit = 500
+
+// Parses a RFC 3339 time, or a date. Dates are the start of the day, or its
+// end when endOfDay is set, so a range of dates includes both days.
+func parseTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return t, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+func getSearchParameters(parameters map[string][]string) (catalog.Query, error) {
+	query := catalog.Query{Limit: 50}
+	if paramQ, ok := parameters["q"]; ok {
+		query.Text = paramQ[0]
+	}
+	if paramTag, ok := parameters["tag"]; ok {
+		query.Tag = paramTag[0]
+	}
+	if paramSite, ok := parameters["site"]; ok {
+		query.Site = paramSite[0]
+	}
+	if paramFrom, ok := parameters["from"]; ok {
+		from, err := parseTime(paramFrom[0], false)
+		if err != nil {
+			return query, &InvalidParametersError{Err: "Error reading 'from' parameter, expected a date or a RFC 3339 time: " + err.Error()}
+		}
+		query.From = from
+	}
+	if paramTo, ok := parameters["to"]; ok {
+		to, err := parseTime(paramTo[0], true)
+		if err != nil {
+			return query, &InvalidParametersError{Err: "Error reading 'to' parameter, expected a date or a RFC 3339 time: " + err.Error()}
+		}
+		query.To = to
+	}
+	if paramLimit, ok := parameters["limit"]; ok {
+		limit, err := strconv.ParseUint(paramLimit[0], 10, 32)
+		if err != nil {
+			return query, &InvalidParametersError{Err: "Error reading 'limit' parameter: " + err.Error()}
+		}
+		if limit < 1 || limit > maxSearchLimit {
+			return query, &InvalidParametersError{Err: fmt.Sprintf("limit must be greater or equal than 1, and lesser or equal than %d.", maxSearchLimit)}
+		}
+		query.Limit = int(limit)
+	}
+	return query, nil
+}
+
+func Search(w http.ResponseWriter, r *http.Request) {
+	query, err := getSearchParameters(r.URL.Query())
+	if err != nil {
+		middlewares.WriteError(w, r, &ResponseError{Err: err.Error(), StatusCode: http.StatusBadRequest})
+		return
+	}
+	memes, err := imagesController.SearchMemes(query)
+	if err != nil {
+		middlewares.WriteError(w, r, &ResponseError{Err: err.Error(), StatusCode: http.StatusInternalServerError})
+		return
+	}
+
+	payload, err := json.Marshal(memes)
+	if err != nil {
+		responseError := &ResponseError{Err: "error encoding return payload", StatusCode: http.StatusInternalServerError}
+		middlewares.WriteError(w, r, responseError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(payload)
+}
@@ -5,8 +5,13 @@ import "fmt"
 type ResponseError struct {
 	Err        string
 	StatusCode int
+	// id of the request that failed, to find its logs
+	RequestID string
 }
 
 func (m *ResponseError) Error() string {
+	if len(m.RequestID) > 0 {
+		return fmt.Sprintf("Error: %s (request id: %s)", m.Err, m.RequestID)
+	}
 	return fmt.Sprintf("Error: %s", m.Err)
 }
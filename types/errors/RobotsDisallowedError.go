@@ -0,0 +1,9 @@
+package errors
+
+type RobotsDisallowedError struct {
+	Err string
+}
+
+func (m *RobotsDisallowedError) Error() string {
+	return "Disallowed by robots.txt :: " + m.Err
+}
@@ -0,0 +1,9 @@
+package errors
+
+type ShuttingDownError struct {
+	Err string
+}
+
+func (m *ShuttingDownError) Error() string {
+	return "Shutting down :: " + m.Err
+}
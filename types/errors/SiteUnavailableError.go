@@ -0,0 +1,13 @@
+package errors
+
+import "time"
+
+type SiteUnavailableError struct {
+	Err string
+	// time until the site is tried again
+	RetryAfter time.Duration
+}
+
+func (m *SiteUnavailableError) Error() string {
+	return "Site unavailable :: " + m.Err
+}
@@ -0,0 +1,10 @@
+package errors
+
+type TimeoutError struct {
+	Err      string
+	RawError error
+}
+
+func (m *TimeoutError) Error() string {
+	return "Timeout :: " + m.Err
+}